@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func runCheckMappings(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("check-mappings", flag.ExitOnError)
+	unmappedOnly := fs.Bool("unmapped", false, "only list directories no mapping covers")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goonhub-stash-importer check-mappings [--unmapped]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	mappings, err := LoadMappings(cfg.MappingsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+	pm, err := NewPathMapper(mappings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+	source, err := OpenSource(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+	scenes, err := source.Scenes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cov := checkCoverage(pm, scenes)
+	cov.print(mappings, cfg.MappingsFile, *unmappedOnly)
+	if len(cov.unmapped) > 0 {
+		os.Exit(1)
+	}
+}
+
+// mappingCoverage is how a source's scene files fall under the path mappings.
+type mappingCoverage struct {
+	files    int
+	dirs     []dirCoverage
+	byLabel  map[string]int      // mapping label -> files
+	unmapped map[string][2]int   // unmapped prefix -> files, directories
+	mapped   map[string]struct{} // directories with mapped files, and their ancestors
+}
+
+type dirCoverage struct {
+	Dir     string
+	Mapping string // label of the mapping, "" if unmapped
+	Files   int
+}
+
+func checkCoverage(pm *PathMapper, scenes []SourceScene) *mappingCoverage {
+	cov := &mappingCoverage{
+		byLabel:  make(map[string]int),
+		unmapped: make(map[string][2]int),
+		mapped:   make(map[string]struct{}),
+	}
+	counts := make(map[dirCoverage]int)
+	for _, sc := range scenes {
+		for _, f := range sc.Files {
+			cov.files++
+			dir := parentDir(normalizePath(f.Path))
+			label := ""
+			if m, err := pm.MapPath(f.Path); err == nil {
+				label = mappingLabel(m.Mapping)
+				cov.byLabel[label]++
+				cov.markMapped(dir)
+			}
+			counts[dirCoverage{Dir: dir, Mapping: label}]++
+		}
+	}
+	for d, n := range counts {
+		d.Files = n
+		cov.dirs = append(cov.dirs, d)
+	}
+	sort.Slice(cov.dirs, func(i, j int) bool {
+		if cov.dirs[i].Dir != cov.dirs[j].Dir {
+			return cov.dirs[i].Dir < cov.dirs[j].Dir
+		}
+		return cov.dirs[i].Mapping < cov.dirs[j].Mapping
+	})
+
+	// Group unmapped directories into the subtrees that hold no mapped files, and
+	// report each subtree by its directories' deepest common ancestor.
+	groups := make(map[string][]dirCoverage)
+	for _, d := range cov.dirs {
+		if d.Mapping == "" {
+			top := cov.unmappedRoot(d.Dir)
+			groups[top] = append(groups[top], d)
+		}
+	}
+	for _, dirs := range groups {
+		prefix := dirs[0].Dir
+		files := 0
+		for _, d := range dirs {
+			prefix = commonDir(prefix, d.Dir)
+			files += d.Files
+		}
+		cov.unmapped[prefix] = [2]int{files, len(dirs)}
+	}
+	return cov
+}
+
+// markMapped records dir and its ancestors as holding mapped files.
+func (cov *mappingCoverage) markMapped(dir string) {
+	if _, ok := cov.mapped[dir]; ok {
+		return
+	}
+	for _, a := range ancestors(dir) {
+		cov.mapped[a] = struct{}{}
+	}
+}
+
+// unmappedRoot returns the highest ancestor of dir that holds no mapped files.
+func (cov *mappingCoverage) unmappedRoot(dir string) string {
+	for _, a := range ancestors(dir) {
+		if _, ok := cov.mapped[a]; !ok {
+			return a
+		}
+	}
+	return dir
+}
+
+// commonDir returns the deepest directory both a and b are under.
+func commonDir(a, b string) string {
+	for !hasPathPrefix(b, a, false) {
+		parent := parentDir(a)
+		if parent == a {
+			break
+		}
+		a = parent
+	}
+	return a
+}
+
+// parentDir is path.Dir for normalised paths; unlike path.Dir it keeps the
+// leading "//" of UNC paths.
+func parentDir(p string) string {
+	i := strings.LastIndex(p, "/")
+	switch {
+	case i < 0:
+		return "."
+	case i == 0:
+		return "/"
+	}
+	return p[:i]
+}
+
+// ancestors lists dir's ancestors from the top down, ending with dir itself.
+// Roots ("/", "D:", "//server") are left out: they'd make useless mappings.
+func ancestors(dir string) []string {
+	parts := strings.Split(dir, "/")
+	start := 1
+	switch {
+	case strings.HasPrefix(dir, "//"):
+		start = 4 // "", "", server, share
+	case parts[0] == "" || strings.HasSuffix(parts[0], ":"):
+		start = 2
+	}
+	var out []string
+	for i := start; i <= len(parts); i++ {
+		out = append(out, strings.Join(parts[:i], "/"))
+	}
+	if len(out) == 0 {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func mappingLabel(m PathMapping) string {
+	if m.StashRegex != "" {
+		return fmt.Sprintf("/%s/ -> %s", m.StashRegex, m.GoonHubPath)
+	}
+	return fmt.Sprintf("%s -> %s", m.StashPrefix, m.GoonHubPrefix)
+}
+
+func (cov *mappingCoverage) print(mappings []PathMapping, file string, unmappedOnly bool) {
+	fmt.Printf("[Check]   %d scene files in %d directories\n\n", cov.files, len(cov.dirs))
+
+	fmt.Printf("%-50s  %6s  %s\n", "DIRECTORY", "FILES", "MAPPING")
+	for _, d := range cov.dirs {
+		if unmappedOnly && d.Mapping != "" {
+			continue
+		}
+		label := d.Mapping
+		if label == "" {
+			label = "(unmapped)"
+		}
+		fmt.Printf("%-50s  %6d  %s\n", d.Dir, d.Files, label)
+	}
+
+	fmt.Println("\nMappings:")
+	for _, m := range mappings {
+		label := mappingLabel(m)
+		if n := cov.byLabel[label]; n > 0 {
+			fmt.Printf("  %-60s  %6d files\n", label, n)
+		} else {
+			fmt.Printf("  %-60s  unused\n", label)
+		}
+	}
+
+	if len(cov.unmapped) == 0 {
+		fmt.Println("\nEvery scene file is covered by a mapping.")
+		return
+	}
+	prefixes := make([]string, 0, len(cov.unmapped))
+	for p := range cov.unmapped {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	fmt.Println("\nUnmapped:")
+	var suggested MappingsConfig
+	for _, p := range prefixes {
+		c := cov.unmapped[p]
+		fmt.Printf("  %-60s  %6d files in %d directories\n", p, c[0], c[1])
+		suggested.PathMappings = append(suggested.PathMappings, PathMapping{StashPrefix: p, GoonHubPrefix: "TODO"})
+	}
+	out, _ := json.MarshalIndent(suggested, "", "  ")
+	fmt.Printf("\nCandidate entries for %s (fill in goonhub_prefix and storage_path_id):\n%s\n", file, out)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +13,10 @@ import (
 type Config struct {
 	StashBaseURL      string
 	StashAPIKey       string
+	StashDBPath       string
+	Source            string
+	NFORoot           string
+	ManifestFile      string
 	GoonHubBaseURL    string
 	GoonHubUsername   string
 	GoonHubPassword   string
@@ -19,41 +24,108 @@ type Config struct {
 	SceneLimit        int
 	DryRun            bool
 	SkipFileCheck     bool
+	VerifyFiles       string
+	VerifyRoot        string
+	CheckpointEvery   int
+	CheckpointPeriod  time.Duration
 	PathMappings      []PathMapping
 	MappingsFile      string
 	IDMapFile         string
+	IDMapStore        string
+	IDMapDBFile       string
+	SyncStateFile     string
+	RunsDir           string
+	FailuresFile      string
+	TagRulesFile      string
+	TransformsFile    string
+	PatternsFile      string
+	SyncResolution    string
 }
 
+// PathMapping maps Stash paths to GoonHub paths either by prefix, or by a
+// regular expression whose match is replaced with GoonHubPath ($1 etc. expand to
+// capture groups). CaseInsensitive makes the prefix or regex ignore case.
 type PathMapping struct {
-	StashPrefix   string `json:"stash_prefix"`
-	GoonHubPrefix string `json:"goonhub_prefix"`
-	StoragePathID uint   `json:"storage_path_id"`
+	StashPrefix     string `json:"stash_prefix,omitempty"`
+	GoonHubPrefix   string `json:"goonhub_prefix,omitempty"`
+	StashRegex      string `json:"stash_regex,omitempty"`
+	GoonHubPath     string `json:"goonhub_path,omitempty"`
+	StoragePathID   uint   `json:"storage_path_id"`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty"`
 }
 
 type MappingsConfig struct {
 	PathMappings []PathMapping `json:"path_mappings"`
 }
 
-func LoadConfig() (*Config, error) {
+// LoadSourceConfig loads the settings that reading the source needs: the source
+// and its connection, and the file names. Commands that never talk to GoonHub
+// use it so they don't need GoonHub credentials.
+func LoadSourceConfig() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
 		StashBaseURL:   os.Getenv("STASH_BASE_URL"),
 		StashAPIKey:    os.Getenv("STASH_API_KEY"),
+		StashDBPath:    os.Getenv("STASH_DB_PATH"),
+		Source:         os.Getenv("SOURCE"),
+		NFORoot:        os.Getenv("NFO_ROOT"),
+		ManifestFile:   os.Getenv("MANIFEST_FILE"),
 		GoonHubBaseURL: os.Getenv("GOONHUB_BASE_URL"),
 		GoonHubUsername: os.Getenv("GOONHUB_USERNAME"),
 		GoonHubPassword: os.Getenv("GOONHUB_PASSWORD"),
 		DryRun:         os.Getenv("DRY_RUN") == "true",
 		SkipFileCheck:  os.Getenv("SKIP_FILE_CHECK") == "true",
+		VerifyFiles:    os.Getenv("VERIFY_FILES"),
+		VerifyRoot:     os.Getenv("VERIFY_ROOT"),
 		MappingsFile:   "mappings.json",
 		IDMapFile:      "id_map.json",
+		IDMapStore:     os.Getenv("IDMAP_STORE"),
+		IDMapDBFile:    "id_map.db",
+		SyncStateFile:  "sync_state.json",
+		RunsDir:        "runs",
+		FailuresFile:   "failures.json",
+		TagRulesFile:   "tag_rules.json",
+		TransformsFile: "transforms.json",
+		PatternsFile:   "filename_patterns.json",
+		SyncResolution: os.Getenv("SYNC_CONFLICT_RESOLUTION"),
 	}
 
-	if cfg.StashBaseURL == "" {
-		return nil, fmt.Errorf("STASH_BASE_URL is required")
+	if cfg.Source == "" {
+		cfg.Source = "stash"
 	}
-	if cfg.StashAPIKey == "" {
-		return nil, fmt.Errorf("STASH_API_KEY is required")
+	switch cfg.Source {
+	case "stash":
+		// Reading the SQLite database directly doesn't need the GraphQL API.
+		if cfg.StashDBPath == "" {
+			if cfg.StashBaseURL == "" {
+				return nil, fmt.Errorf("STASH_BASE_URL is required (or set STASH_DB_PATH)")
+			}
+			if cfg.StashAPIKey == "" {
+				return nil, fmt.Errorf("STASH_API_KEY is required (or set STASH_DB_PATH)")
+			}
+		}
+	case "nfo":
+		if cfg.NFORoot == "" {
+			return nil, fmt.Errorf("NFO_ROOT is required when SOURCE=nfo")
+		}
+	case "manifest":
+		if cfg.ManifestFile == "" {
+			return nil, fmt.Errorf("MANIFEST_FILE is required when SOURCE=manifest")
+		}
+	default:
+		return nil, fmt.Errorf("unknown SOURCE %q (expected stash, nfo or manifest)", cfg.Source)
+	}
+
+	return cfg, nil
+}
+
+// LoadConfig loads the full configuration: LoadSourceConfig's settings plus the
+// GoonHub connection and run options.
+func LoadConfig() (*Config, error) {
+	cfg, err := LoadSourceConfig()
+	if err != nil {
+		return nil, err
 	}
 	if cfg.GoonHubBaseURL == "" {
 		return nil, fmt.Errorf("GOONHUB_BASE_URL is required")
@@ -83,6 +155,41 @@ func LoadConfig() (*Config, error) {
 		cfg.SceneLimit = limit
 	}
 
+	switch cfg.IDMapStore {
+	case "":
+		cfg.IDMapStore = "json"
+	case "json", "sqlite":
+	default:
+		return nil, fmt.Errorf("unknown IDMAP_STORE %q (expected json or sqlite)", cfg.IDMapStore)
+	}
+
+	// ID map checkpoints inside long phases: every N entities or seconds.
+	cfg.CheckpointEvery = 100
+	if s := os.Getenv("IDMAP_CHECKPOINT_EVERY"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("IDMAP_CHECKPOINT_EVERY must be a positive integer: %s", s)
+		}
+		cfg.CheckpointEvery = n
+	}
+	cfg.CheckpointPeriod = 30 * time.Second
+	if s := os.Getenv("IDMAP_CHECKPOINT_SECONDS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("IDMAP_CHECKPOINT_SECONDS must be a positive integer: %s", s)
+		}
+		cfg.CheckpointPeriod = time.Duration(n) * time.Second
+	}
+
+	switch cfg.VerifyFiles {
+	case "", "size", "oshash":
+	default:
+		return nil, fmt.Errorf("unknown VERIFY_FILES %q (expected size or oshash)", cfg.VerifyFiles)
+	}
+	if cfg.VerifyRoot == "" {
+		cfg.VerifyRoot = "."
+	}
+
 	return cfg, nil
 }
 
@@ -103,6 +210,23 @@ func LoadMappings(path string) ([]PathMapping, error) {
 	if len(mappings.PathMappings) == 0 {
 		return nil, fmt.Errorf("no path_mappings defined in %s", path)
 	}
+	for i, m := range mappings.PathMappings {
+		if (m.StashPrefix == "") == (m.StashRegex == "") {
+			return nil, fmt.Errorf("path mapping %d in %s needs either stash_prefix or stash_regex", i+1, path)
+		}
+	}
 
 	return mappings.PathMappings, nil
 }
+
+// SaveMappings writes mappings back to the mappings file.
+func SaveMappings(path string, mappings []PathMapping) error {
+	data, err := json.MarshalIndent(MappingsConfig{PathMappings: mappings}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mappings: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write mappings file: %w", err)
+	}
+	return nil
+}
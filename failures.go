@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// FailureList persists the entities that failed to import, per phase, so
+// retry-failed can re-attempt just those. Entries are added as imports fail and
+// dropped once the entity is mapped or deliberately skipped.
+// A nil *FailureList records nothing, like a nil *RunJournal.
+type FailureList struct {
+	Phases map[string]map[string]Failure `json:"phases"`
+}
+
+type Failure struct {
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts"`
+}
+
+// LoadFailureList reads the failure list. Returns an empty list if the file doesn't exist.
+func LoadFailureList(path string) (*FailureList, error) {
+	list := &FailureList{Phases: make(map[string]map[string]Failure)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return list, nil
+		}
+		return nil, fmt.Errorf("failed to read failure list: %w", err)
+	}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("failed to parse failure list: %w", err)
+	}
+	if list.Phases == nil {
+		list.Phases = make(map[string]map[string]Failure)
+	}
+	return list, nil
+}
+
+// Save writes the failure list, removing the file when nothing is left to retry.
+func (l *FailureList) Save(path string) error {
+	if l == nil {
+		return nil
+	}
+	if l.Len() == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove failure list: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal failure list: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write failure list: %w", err)
+	}
+	return nil
+}
+
+func (l *FailureList) Failed(phase, sourceID string, err error) {
+	if l == nil {
+		return
+	}
+	ids := l.Phases[phase]
+	if ids == nil {
+		ids = make(map[string]Failure)
+		l.Phases[phase] = ids
+	}
+	f := ids[sourceID]
+	f.Error = err.Error()
+	f.Time = time.Now().UTC()
+	f.Attempts++
+	ids[sourceID] = f
+}
+
+func (l *FailureList) Resolved(phase, sourceID string) {
+	if l == nil {
+		return
+	}
+	delete(l.Phases[phase], sourceID)
+	if len(l.Phases[phase]) == 0 {
+		delete(l.Phases, phase)
+	}
+}
+
+// ResolveMapped drops the entries of a phase that are now in the ID map.
+func (l *FailureList) ResolveMapped(phase string, ids map[string]uint) {
+	if l == nil {
+		return
+	}
+	for id := range l.Phases[phase] {
+		if _, ok := ids[id]; ok {
+			l.Resolved(phase, id)
+		}
+	}
+}
+
+func (l *FailureList) Len() int {
+	n := 0
+	for _, ids := range l.Phases {
+		n += len(ids)
+	}
+	return n
+}
+
+// IDs returns the failed source IDs of a phase owned by source, sorted.
+func (l *FailureList) IDs(phase, source string) []string {
+	var out []string
+	for id := range l.Phases[phase] {
+		if ownsID(source, id) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// errNoIDLookup is returned by IDSource implementations that can't look entities
+// up by ID after all, e.g. a Stash source backed by the SQLite database.
+var errNoIDLookup = errors.New("source can't fetch entities by ID")
+
+// failurePhases are the phases failures are recorded for, in import order.
+var failurePhases = []string{"Tags", "Studios", "Actors", "Scenes", "Markers", "Searches"}
+
+// FetchFailedData re-reads the failed entities from the source, plus the markers
+// of failed scenes (which were skipped because their scene wasn't imported). It
+// uses the source's ID lookups when it has them and otherwise filters a full fetch.
+func FetchFailedData(source Source, failures *FailureList, parser *FilenameParser) (*SourceData, error) {
+	ids := make(map[string][]string)
+	for _, phase := range failurePhases {
+		ids[phase] = failures.IDs(phase, source.Name())
+	}
+	fmt.Printf("\n[Source]  Re-fetching failed entities from %s (tags:%d studios:%d actors:%d scenes:%d markers:%d searches:%d)...\n",
+		source.Name(), len(ids["Tags"]), len(ids["Studios"]), len(ids["Actors"]), len(ids["Scenes"]), len(ids["Markers"]), len(ids["Searches"]))
+
+	data, err := fetchFailedEntities(source, ids, parser)
+	if err != nil {
+		return nil, err
+	}
+
+	// Saved filters have no ID lookup; filter the full list.
+	if saved, ok := source.(SavedFilterSource); ok && len(ids["Searches"]) > 0 {
+		filters, err := saved.SavedFilters()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch saved filters: %w", err)
+		}
+		data.SavedFilters = filterByID(filters, ids["Searches"], func(f SourceSavedFilter) string { return f.ID })
+	}
+	return data, nil
+}
+
+// fetchFailedEntities fetches the failed tags, studios, performers, scenes and
+// markers.
+func fetchFailedEntities(source Source, ids map[string][]string, parser *FilenameParser) (*SourceData, error) {
+	if byID, ok := source.(IDSource); ok {
+		data, err := byID.FetchByID(ids)
+		if !errors.Is(err, errNoIDLookup) {
+			if err != nil || parser.Len() == 0 {
+				return data, err
+			}
+			// The parser links names against every studio and performer.
+			all := &SourceData{Scenes: data.Scenes}
+			if all.Studios, err = source.Studios(); err != nil {
+				return nil, fmt.Errorf("failed to fetch studios: %w", err)
+			}
+			if all.Performers, err = source.Performers(); err != nil {
+				return nil, fmt.Errorf("failed to fetch performers: %w", err)
+			}
+			parser.Apply(all)
+			return data, nil
+		}
+	}
+
+	all, err := FetchSourceData(source, nil, parser, 0)
+	if err != nil {
+		return nil, err
+	}
+	data := &SourceData{
+		Tags:       filterByID(all.Tags, ids["Tags"], func(t SourceTag) string { return t.ID }),
+		Studios:    filterByID(all.Studios, ids["Studios"], func(s SourceStudio) string { return s.ID }),
+		Performers: filterByID(all.Performers, ids["Actors"], func(p SourcePerformer) string { return p.ID }),
+		Scenes:     filterByID(all.Scenes, ids["Scenes"], func(s SourceScene) string { return s.ID }),
+	}
+	markerIDs := make(map[string]bool, len(ids["Markers"]))
+	for _, id := range ids["Markers"] {
+		markerIDs[id] = true
+	}
+	for _, m := range all.Markers {
+		if markerIDs[m.ID] {
+			data.Markers = append(data.Markers, m)
+		}
+	}
+	data.Markers = mergeMarkers(data.Markers, markersForScenes(all.Markers, data.Scenes))
+	return data, nil
+}
+
+func filterByID[T any](items []T, ids []string, id func(T) string) []T {
+	keep := make(map[string]bool, len(ids))
+	for _, i := range ids {
+		keep[i] = true
+	}
+	var out []T
+	for _, item := range items {
+		if keep[id(item)] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// mergeMarkers appends the markers of b not already in a.
+func mergeMarkers(a, b []SourceMarker) []SourceMarker {
+	seen := make(map[string]bool, len(a))
+	for _, m := range a {
+		seen[m.ID] = true
+	}
+	for _, m := range b {
+		if !seen[m.ID] {
+			seen[m.ID] = true
+			a = append(a, m)
+		}
+	}
+	return a
+}
+
+// printFailures lists what retry-failed would re-attempt.
+func printFailures(failures *FailureList) {
+	for _, phase := range failurePhases {
+		ids := failures.Phases[phase]
+		keys := make([]string, 0, len(ids))
+		for id := range ids {
+			keys = append(keys, id)
+		}
+		sort.Strings(keys)
+		for _, id := range keys {
+			f := ids[id]
+			fmt.Printf("[Retry]   %-7s %s (%d attempt(s), last %s): %s\n",
+				singular(phase), id, f.Attempts, f.Time.Local().Format("2006-01-02 15:04"), f.Error)
+		}
+	}
+}
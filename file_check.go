@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileChecker verifies scene files on the local disk before import, for runs on
+// the GoonHub host. Mapped GoonHub paths are resolved against root; a file is
+// present when it exists with the size the source reports (and, in "oshash"
+// mode, the same oshash when the source has one).
+type FileChecker struct {
+	mode string // "size" or "oshash"
+	root string
+
+	problems []fileProblem
+}
+
+type fileProblem struct {
+	SceneID   string
+	Status    string // "missing" or "mismatched"
+	Detail    string
+	Path      string // source path
+	LocalPath string
+}
+
+// NewFileChecker returns nil unless VERIFY_FILES is set.
+func NewFileChecker(cfg *Config) *FileChecker {
+	if cfg.VerifyFiles == "" {
+		return nil
+	}
+	return &FileChecker{mode: cfg.VerifyFiles, root: cfg.VerifyRoot}
+}
+
+// Check classifies a scene's file as present, missing or mismatched. Problems
+// are returned as errors and kept for Report.
+func (c *FileChecker) Check(sceneID string, file SourceFile, ghPath string) error {
+	if c == nil {
+		return nil
+	}
+	local := filepath.FromSlash(ghPath)
+	if !filepath.IsAbs(local) {
+		local = filepath.Join(c.root, local)
+	}
+
+	status, detail := c.classify(file, local)
+	if status == "present" {
+		return nil
+	}
+	c.problems = append(c.problems, fileProblem{SceneID: sceneID, Status: status, Detail: detail, Path: file.Path, LocalPath: local})
+	return fmt.Errorf("file %s: %s", status, detail)
+}
+
+func (c *FileChecker) classify(file SourceFile, local string) (status, detail string) {
+	info, err := os.Stat(local)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "missing", local + " not found"
+		}
+		return "missing", err.Error()
+	}
+	if info.IsDir() {
+		return "missing", local + " is a directory"
+	}
+	if file.Size > 0 && info.Size() != file.Size {
+		return "mismatched", fmt.Sprintf("size %d, source says %d", info.Size(), file.Size)
+	}
+	if c.mode == "oshash" && file.OSHash != "" {
+		hash, err := fileOSHash(local, info.Size())
+		if err != nil {
+			return "mismatched", err.Error()
+		}
+		if hash != file.OSHash {
+			return "mismatched", fmt.Sprintf("oshash %s, source says %s", hash, file.OSHash)
+		}
+	}
+	return "present", ""
+}
+
+// Report prints the files that were missing or mismatched, if any.
+func (c *FileChecker) Report() {
+	if c == nil || len(c.problems) == 0 {
+		return
+	}
+	missing := 0
+	for _, p := range c.problems {
+		if p.Status == "missing" {
+			missing++
+		}
+	}
+	fmt.Printf("\n[Files]   %d missing and %d mismatched file(s):\n", missing, len(c.problems)-missing)
+	for _, p := range c.problems {
+		fmt.Printf("[Files]   %-10s scene %s: %s (%s)\n", p.Status, p.SceneID, p.Path, p.Detail)
+	}
+}
+
+// fileOSHash computes the OpenSubtitles hash Stash uses: the file size plus the
+// little-endian uint64 sums of its first and last 64 KiB.
+func fileOSHash(path string, size int64) (string, error) {
+	const chunkSize = 64 * 1024
+	if size == 0 {
+		return "", errors.New("can't compute oshash of an empty file")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for oshash: %w", err)
+	}
+	defer f.Close()
+
+	n := int64(chunkSize)
+	if size < n {
+		n = size
+	}
+	buf := make([]byte, n)
+	sum := uint64(size)
+	for _, off := range []int64{0, size - n} {
+		if _, err := f.ReadAt(buf, off); err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read file for oshash: %w", err)
+		}
+		for i := 0; i+8 <= len(buf); i += 8 {
+			sum += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", sum), nil
+}
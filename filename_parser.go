@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FilenameParser fills in title, date, studio and performers for scenes without
+// a title, from their file name. Patterns work like Stash's scene filename
+// parser: literal text plus fields in braces, e.g.
+//
+//	{studio}.{yy}.{mm}.{dd}.{performer}.{title}.{i}.{ext}
+//
+// A pattern containing "/" is matched against the end of the file's path,
+// otherwise against the whole base name. The first matching pattern wins.
+type FilenameParser struct {
+	Patterns []string `json:"patterns"`
+	// Whitespace lists the characters read as spaces in titles and names.
+	Whitespace string `json:"whitespace"`
+
+	compiled []filenamePattern
+}
+
+type filenamePattern struct {
+	text   string
+	re     *regexp.Regexp
+	fields []string // field of each capture group
+	path   bool
+}
+
+// filenameFields maps pattern fields to the regexp they match. {title} is greedy
+// and the other names lazy, so a title takes whatever the rest of the pattern
+// leaves over. {i} matches anything and is ignored. No field spans a "/", so a
+// path pattern's fields line up with whole directory names.
+var filenameFields = map[string]string{
+	"title":     `([^/]+)`,
+	"studio":    `([^/]+?)`,
+	"performer": `([^/]+?)`,
+	"date":      `(\d{4}[-._ ]\d{2}[-._ ]\d{2})`,
+	"yyyy":      `(\d{4})`,
+	"yy":        `(\d{2})`,
+	"mm":        `(\d{2})`,
+	"dd":        `(\d{2})`,
+	"ext":       `(\w+)`,
+	"i":         `([^/]*?)`,
+}
+
+var filenameFieldRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// LoadFilenameParser reads the filename patterns file. The file is optional:
+// returns a parser with no patterns if it doesn't exist.
+func LoadFilenameParser(path string) (*FilenameParser, error) {
+	p := &FilenameParser{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, fmt.Errorf("failed to read filename patterns: %w", err)
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse filename patterns: %w", err)
+	}
+	if p.Whitespace == "" {
+		p.Whitespace = "._"
+	}
+	for _, text := range p.Patterns {
+		fp, err := compileFilenamePattern(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename pattern %q in %s: %w", text, path, err)
+		}
+		p.compiled = append(p.compiled, fp)
+	}
+	return p, nil
+}
+
+func compileFilenamePattern(text string) (filenamePattern, error) {
+	fp := filenamePattern{text: text, path: strings.Contains(text, "/")}
+	var expr strings.Builder
+	if fp.path {
+		expr.WriteString(`(?:^|/)`)
+	} else {
+		expr.WriteString(`^`)
+	}
+	last := 0
+	for _, m := range filenameFieldRe.FindAllStringSubmatchIndex(text, -1) {
+		expr.WriteString(regexp.QuoteMeta(text[last:m[0]]))
+		field := text[m[2]:m[3]]
+		re, ok := filenameFields[field]
+		if !ok {
+			return fp, fmt.Errorf("unknown field {%s}", field)
+		}
+		expr.WriteString(re)
+		fp.fields = append(fp.fields, field)
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(text[last:]))
+	expr.WriteString(`$`)
+	if len(fp.fields) == 0 {
+		return fp, fmt.Errorf("no fields")
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return fp, err
+	}
+	fp.re = re
+	return fp, nil
+}
+
+func (p *FilenameParser) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.compiled)
+}
+
+// parsedFilename is what a pattern extracted; empty fields weren't matched.
+type parsedFilename struct {
+	Title      string
+	Date       string
+	Studio     string
+	Performers []string
+}
+
+// Parse matches a file path against the patterns.
+func (p *FilenameParser) Parse(path string) (parsedFilename, bool) {
+	path = strings.ReplaceAll(path, `\`, "/")
+	base := path[strings.LastIndex(path, "/")+1:]
+
+	for _, fp := range p.compiled {
+		subject := base
+		if fp.path {
+			subject = path
+		}
+		m := fp.re.FindStringSubmatch(subject)
+		if m == nil {
+			continue
+		}
+
+		var out parsedFilename
+		var yyyy, yy, mm, dd string
+		for i, field := range fp.fields {
+			v := m[i+1]
+			switch field {
+			case "title":
+				out.Title = p.words(v)
+			case "studio":
+				out.Studio = p.words(v)
+			case "performer":
+				if name := p.words(v); name != "" {
+					out.Performers = append(out.Performers, name)
+				}
+			case "date":
+				yyyy, mm, dd = v[0:4], v[5:7], v[8:10]
+			case "yyyy":
+				yyyy = v
+			case "yy":
+				yy = v
+			case "mm":
+				mm = v
+			case "dd":
+				dd = v
+			}
+		}
+		if yyyy == "" && yy != "" {
+			yyyy = expandYear(yy)
+		}
+		if yyyy != "" && mm != "" && dd != "" {
+			d := yyyy + "-" + mm + "-" + dd
+			if _, err := time.Parse("2006-01-02", d); err == nil {
+				out.Date = d
+			}
+		}
+		return out, true
+	}
+	return parsedFilename{}, false
+}
+
+// words turns separator characters into spaces and collapses runs of them.
+func (p *FilenameParser) words(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(p.Whitespace, r)
+	}), " ")
+}
+
+// expandYear reads a two-digit year as this century unless that's in the future.
+func expandYear(yy string) string {
+	n, _ := strconv.Atoi(yy)
+	now := time.Now().Year()
+	year := now/100*100 + n
+	if year > now {
+		year -= 100
+	}
+	return strconv.Itoa(year)
+}
+
+// Apply fills in untitled scenes from their first file's name. Only fields the
+// scene lacks are set; studio and performer names are linked to the source's
+// studios and performers by name, ignoring case, spaces and punctuation.
+func (p *FilenameParser) Apply(data *SourceData) {
+	if p.Len() == 0 {
+		return
+	}
+	studios := make(map[string]string, len(data.Studios))
+	for _, s := range data.Studios {
+		studios[nameKey(s.Name)] = s.ID
+	}
+	performers := make(map[string]string, len(data.Performers))
+	for _, pf := range data.Performers {
+		performers[nameKey(pf.Name)] = pf.ID
+	}
+
+	untitled, parsed := 0, 0
+	for i := range data.Scenes {
+		sc := &data.Scenes[i]
+		if sc.Title != "" || len(sc.Files) == 0 {
+			continue
+		}
+		untitled++
+		out, ok := p.Parse(sc.Files[0].Path)
+		if !ok {
+			continue
+		}
+		parsed++
+
+		sc.Title = out.Title
+		if sc.Date == nil && out.Date != "" {
+			sc.Date = &out.Date
+		}
+		if sc.StudioID == "" && out.Studio != "" {
+			if id, ok := studios[nameKey(out.Studio)]; ok {
+				sc.StudioID = id
+			} else {
+				fmt.Printf("[Parser]  Scene %s: no studio named %q\n", sc.ID, out.Studio)
+			}
+		}
+		if len(sc.PerformerIDs) == 0 {
+			for _, name := range out.Performers {
+				if id, ok := performers[nameKey(name)]; ok {
+					sc.PerformerIDs = append(sc.PerformerIDs, id)
+				} else {
+					fmt.Printf("[Parser]  Scene %s: no performer named %q\n", sc.ID, name)
+				}
+			}
+		}
+	}
+	if untitled > 0 {
+		fmt.Printf("[Parser]  Parsed %d of %d untitled scenes from their file names\n", parsed, untitled)
+	}
+}
+
+// nameKey reduces a name to its lower-cased letters and digits.
+func nameKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
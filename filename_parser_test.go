@@ -0,0 +1,218 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustFilenameParser(t *testing.T, patterns ...string) *FilenameParser {
+	t.Helper()
+	p := &FilenameParser{Patterns: patterns, Whitespace: "._"}
+	for _, text := range patterns {
+		fp, err := compileFilenamePattern(text)
+		if err != nil {
+			t.Fatalf("compileFilenamePattern(%q): %v", text, err)
+		}
+		p.compiled = append(p.compiled, fp)
+	}
+	return p
+}
+
+func TestFilenameParserParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     parsedFilename
+		wantOK   bool
+	}{
+		{
+			name:     "studio, date, performers and title",
+			patterns: []string{"{studio} - {date} - {performer} & {performer} - {title}.{ext}"},
+			path:     "/data/Acme - 2024-03-15 - Jane Doe & John_Smith - Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day", Date: "2024-03-15", Studio: "Acme", Performers: []string{"Jane Doe", "John Smith"}},
+			wantOK:   true,
+		},
+		{
+			name:     "repeated performer with dots",
+			patterns: []string{"{performer}.{performer}.{title}.{ext}"},
+			path:     "/data/Jane.John.Scene.Title.mp4",
+			want:     parsedFilename{Title: "Scene Title", Performers: []string{"Jane", "John"}},
+			wantOK:   true,
+		},
+		{
+			name:     "two-digit year",
+			patterns: []string{"{studio}.{yy}.{mm}.{dd}.{title}.{ext}"},
+			path:     "/data/Acme.24.03.15.Big.Day.mp4",
+			want:     parsedFilename{Title: "Big Day", Date: "2024-03-15", Studio: "Acme"},
+			wantOK:   true,
+		},
+		{
+			name:     "two-digit year in the future is last century",
+			patterns: []string{"{yy}{mm}{dd} {title}.{ext}"},
+			path:     "/data/991231 Party.mp4",
+			want:     parsedFilename{Title: "Party", Date: "1999-12-31"},
+			wantOK:   true,
+		},
+		{
+			name:     "four-digit year",
+			patterns: []string{"{yyyy}.{mm}.{dd} {title}.{ext}"},
+			path:     "/data/2023.12.01 Winter Trip.mkv",
+			want:     parsedFilename{Title: "Winter Trip", Date: "2023-12-01"},
+			wantOK:   true,
+		},
+		{
+			name:     "date with underscores",
+			patterns: []string{"{date}_{title}.{ext}"},
+			path:     "/data/2024_01_02_Big_Day.mp4",
+			want:     parsedFilename{Title: "Big Day", Date: "2024-01-02"},
+			wantOK:   true,
+		},
+		{
+			name:     "invalid date is dropped",
+			patterns: []string{"{yyyy}-{mm}-{dd} {title}.{ext}"},
+			path:     "/data/2024-13-40 Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day"},
+			wantOK:   true,
+		},
+		{
+			name:     "date without day is dropped",
+			patterns: []string{"{yyyy}-{mm} {title}.{ext}"},
+			path:     "/data/2024-03 Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day"},
+			wantOK:   true,
+		},
+		{
+			name:     "ignored field",
+			patterns: []string{"{title} [{i}].{ext}"},
+			path:     "/data/Big Day [1080p].mp4",
+			want:     parsedFilename{Title: "Big Day"},
+			wantOK:   true,
+		},
+		{
+			name:     "literal regexp characters",
+			patterns: []string{"({studio}) {title}.{ext}"},
+			path:     "/data/(Acme.Inc) Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day", Studio: "Acme Inc"},
+			wantOK:   true,
+		},
+		{
+			name:     "path pattern",
+			patterns: []string{"{studio}/{title}.{ext}"},
+			path:     `D:\Videos\Acme\Big.Day.mp4`,
+			want:     parsedFilename{Title: "Big Day", Studio: "Acme"},
+			wantOK:   true,
+		},
+		{
+			name:     "base name pattern ignores directories",
+			patterns: []string{"{studio} - {title}.{ext}"},
+			path:     "/data/Acme - Studio/Big Day.mp4",
+			wantOK:   false,
+		},
+		{
+			name:     "first matching pattern wins",
+			patterns: []string{"{performer} - {title}.{ext}", "{title}.{ext}"},
+			path:     "/data/Jane - Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day", Performers: []string{"Jane"}},
+			wantOK:   true,
+		},
+		{
+			name:     "falls through to the next pattern",
+			patterns: []string{"{performer} - {title}.{ext}", "{title}.{ext}"},
+			path:     "/data/Big Day.mp4",
+			want:     parsedFilename{Title: "Big Day"},
+			wantOK:   true,
+		},
+		{
+			name:     "no match",
+			patterns: []string{"{studio} - {title}.{ext}"},
+			path:     "/data/Big Day.mp4",
+			wantOK:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mustFilenameParser(t, tt.patterns...).Parse(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("Parse(%q) matched = %v, want %v", tt.path, ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilenamePatternErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{"unknown field", "{studio} - {name}.{ext}"},
+		{"no fields", "scene.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileFilenamePattern(tt.pattern); err == nil {
+				t.Errorf("compileFilenamePattern(%q) accepted an invalid pattern", tt.pattern)
+			}
+		})
+	}
+}
+
+func TestFilenameParserApply(t *testing.T) {
+	date := "2020-01-01"
+	data := &SourceData{
+		Studios:    []SourceStudio{{ID: "s1", Name: "Acme Inc."}},
+		Performers: []SourcePerformer{{ID: "p1", Name: "Jane Doe"}, {ID: "p2", Name: "John O'Smith"}},
+		Scenes: []SourceScene{
+			{ID: "1", Files: []SourceFile{{Path: "/data/acme inc - 2024-03-15 - Jane_Doe & John OSmith - Big Day.mp4"}}},
+			{ID: "2", Title: "Kept", Files: []SourceFile{{Path: "/data/Acme Inc - 2024-03-15 - Jane Doe & Nobody - Other.mp4"}}},
+			{ID: "3", Date: &date, StudioID: "s9", PerformerIDs: []string{"p9"},
+				Files: []SourceFile{{Path: "/data/Acme Inc - 2024-03-15 - Jane Doe & Nobody - Third.mp4"}}},
+			{ID: "4", Files: []SourceFile{{Path: "/data/Nomatch - Big Day.mp4"}}},
+			{ID: "5"},
+		},
+	}
+	mustFilenameParser(t, "{studio} - {date} - {performer} & {performer} - {title}.{ext}").Apply(data)
+
+	tests := []struct {
+		id         string
+		title      string
+		date       string
+		studio     string
+		performers []string
+	}{
+		{"1", "Big Day", "2024-03-15", "s1", []string{"p1", "p2"}},
+		{"2", "Kept", "", "", nil},
+		{"3", "Third", "2020-01-01", "s9", []string{"p9"}},
+		{"4", "", "", "", nil},
+		{"5", "", "", "", nil},
+	}
+	for i, tt := range tests {
+		sc := data.Scenes[i]
+		gotDate := ""
+		if sc.Date != nil {
+			gotDate = *sc.Date
+		}
+		if sc.Title != tt.title || gotDate != tt.date || sc.StudioID != tt.studio || !reflect.DeepEqual(sc.PerformerIDs, tt.performers) {
+			t.Errorf("scene %s = %q, date %q, studio %q, performers %v, want %q, %q, %q, %v",
+				tt.id, sc.Title, gotDate, sc.StudioID, sc.PerformerIDs, tt.title, tt.date, tt.studio, tt.performers)
+		}
+	}
+}
+
+func TestExpandYear(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"00", "2000"},
+		{"24", "2024"},
+		{"99", "1999"},
+	}
+	for _, tt := range tests {
+		if got := expandYear(tt.in); got != tt.want {
+			t.Errorf("expandYear(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -63,6 +63,10 @@ func (c *GoonHubClient) doRequest(method, path string, body any, result any) err
 		return &ConflictError{Message: string(respBody), ExistingID: conflictData.ID}
 	}
 
+	if resp.StatusCode == http.StatusNotFound {
+		return &NotFoundError{Message: string(respBody)}
+	}
+
 	if resp.StatusCode >= 500 {
 		return &ServerError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
@@ -155,6 +159,21 @@ func (c *GoonHubClient) CreateTag(name, color string) (*GHTag, error) {
 	return &tag, nil
 }
 
+func (c *GoonHubClient) UpdateTag(id uint, req GHUpdateTagRequest) error {
+	path := fmt.Sprintf("/api/v1/tags/%d", id)
+	if err := c.doWithRetry("PUT", path, req, nil); err != nil {
+		return fmt.Errorf("failed to update tag: %w", err)
+	}
+	return nil
+}
+
+func (c *GoonHubClient) DeleteTag(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/tags/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+	return nil
+}
+
 // --- Studios ---
 
 func (c *GoonHubClient) ListStudios() ([]GHStudioListItem, error) {
@@ -167,6 +186,14 @@ func (c *GoonHubClient) ListStudios() ([]GHStudioListItem, error) {
 	return resp.Data, nil
 }
 
+func (c *GoonHubClient) GetStudio(id uint) (*GHStudio, error) {
+	var studio GHStudio
+	if err := c.doWithRetry("GET", fmt.Sprintf("/api/v1/studios/%d", id), nil, &studio); err != nil {
+		return nil, fmt.Errorf("failed to get studio: %w", err)
+	}
+	return &studio, nil
+}
+
 func (c *GoonHubClient) CreateStudio(req GHCreateStudioRequest) (*GHStudio, error) {
 	var studio GHStudio
 	if err := c.doWithRetry("POST", "/api/v1/admin/studios", req, &studio); err != nil {
@@ -183,6 +210,13 @@ func (c *GoonHubClient) UpdateStudio(id uint, req GHUpdateStudioRequest) error {
 	return nil
 }
 
+func (c *GoonHubClient) DeleteStudio(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/admin/studios/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete studio: %w", err)
+	}
+	return nil
+}
+
 // --- Actors ---
 
 func (c *GoonHubClient) ListActors() ([]GHActorListItem, error) {
@@ -195,6 +229,14 @@ func (c *GoonHubClient) ListActors() ([]GHActorListItem, error) {
 	return resp.Data, nil
 }
 
+func (c *GoonHubClient) GetActor(id uint) (*GHActor, error) {
+	var actor GHActor
+	if err := c.doWithRetry("GET", fmt.Sprintf("/api/v1/actors/%d", id), nil, &actor); err != nil {
+		return nil, fmt.Errorf("failed to get actor: %w", err)
+	}
+	return &actor, nil
+}
+
 func (c *GoonHubClient) CreateActor(req GHCreateActorRequest) (*GHActor, error) {
 	var actor GHActor
 	if err := c.doWithRetry("POST", "/api/v1/admin/actors", req, &actor); err != nil {
@@ -203,6 +245,39 @@ func (c *GoonHubClient) CreateActor(req GHCreateActorRequest) (*GHActor, error)
 	return &actor, nil
 }
 
+func (c *GoonHubClient) UpdateActor(id uint, req GHUpdateActorRequest) error {
+	path := fmt.Sprintf("/api/v1/admin/actors/%d", id)
+	if err := c.doWithRetry("PUT", path, req, nil); err != nil {
+		return fmt.Errorf("failed to update actor: %w", err)
+	}
+	return nil
+}
+
+func (c *GoonHubClient) DeleteActor(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/admin/actors/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete actor: %w", err)
+	}
+	return nil
+}
+
+// --- Scenes ---
+
+func (c *GoonHubClient) GetScene(id uint) (*GHScene, error) {
+	var scene GHScene
+	if err := c.doWithRetry("GET", fmt.Sprintf("/api/v1/scenes/%d", id), nil, &scene); err != nil {
+		return nil, fmt.Errorf("failed to get scene: %w", err)
+	}
+	return &scene, nil
+}
+
+func (c *GoonHubClient) UpdateScene(id uint, req GHUpdateSceneRequest) error {
+	path := fmt.Sprintf("/api/v1/admin/scenes/%d", id)
+	if err := c.doWithRetry("PUT", path, req, nil); err != nil {
+		return fmt.Errorf("failed to update scene: %w", err)
+	}
+	return nil
+}
+
 // --- Scenes (Import) ---
 
 func (c *GoonHubClient) ImportScene(req GHImportSceneRequest) (*GHImportSceneResponse, error) {
@@ -231,7 +306,8 @@ func (c *GoonHubClient) SetSceneActors(sceneID uint, actorIDs []uint) error {
 	return nil
 }
 
-func (c *GoonHubClient) SetSceneStudio(sceneID uint, studioID uint) error {
+// SetSceneStudio sets a scene's studio, or clears it when studioID is nil.
+func (c *GoonHubClient) SetSceneStudio(sceneID uint, studioID *uint) error {
 	path := fmt.Sprintf("/api/v1/scenes/%d/studio", sceneID)
 	if err := c.doWithRetry("PUT", path, GHSetStudioRequest{StudioID: studioID}, nil); err != nil {
 		return fmt.Errorf("failed to set scene studio: %w", err)
@@ -239,6 +315,13 @@ func (c *GoonHubClient) SetSceneStudio(sceneID uint, studioID uint) error {
 	return nil
 }
 
+func (c *GoonHubClient) DeleteScene(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/admin/scenes/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete scene: %w", err)
+	}
+	return nil
+}
+
 // --- Markers (Import) ---
 
 func (c *GoonHubClient) ImportMarker(req GHImportMarkerRequest) (*GHImportMarkerResponse, error) {
@@ -257,6 +340,52 @@ func (c *GoonHubClient) SetMarkerTags(markerID uint, tagIDs []uint) error {
 	return nil
 }
 
+func (c *GoonHubClient) DeleteMarker(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/markers/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete marker: %w", err)
+	}
+	return nil
+}
+
+// --- Storage paths ---
+
+func (c *GoonHubClient) ListStoragePaths() ([]GHStoragePath, error) {
+	var resp struct {
+		Data []GHStoragePath `json:"data"`
+	}
+	if err := c.doWithRetry("GET", "/api/v1/admin/storage-paths", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list storage paths: %w", err)
+	}
+	return resp.Data, nil
+}
+
+// --- Saved searches ---
+
+func (c *GoonHubClient) ListSavedSearches() ([]GHSavedSearch, error) {
+	var resp struct {
+		Data []GHSavedSearch `json:"data"`
+	}
+	if err := c.doWithRetry("GET", "/api/v1/saved-searches", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list saved searches: %w", err)
+	}
+	return resp.Data, nil
+}
+
+func (c *GoonHubClient) CreateSavedSearch(req GHCreateSavedSearchRequest) (*GHSavedSearch, error) {
+	var search GHSavedSearch
+	if err := c.doWithRetry("POST", "/api/v1/saved-searches", req, &search); err != nil {
+		return nil, fmt.Errorf("failed to create saved search: %w", err)
+	}
+	return &search, nil
+}
+
+func (c *GoonHubClient) DeleteSavedSearch(id uint) error {
+	if err := c.doWithRetry("DELETE", fmt.Sprintf("/api/v1/saved-searches/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	return nil
+}
+
 // --- Error types ---
 
 type ConflictError struct {
@@ -276,3 +405,11 @@ type ServerError struct {
 func (e *ServerError) Error() string {
 	return fmt.Sprintf("server error %d: %s", e.StatusCode, e.Body)
 }
+
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("not found: %s", e.Message)
+}
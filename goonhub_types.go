@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // GoonHub API request/response types
 
 // --- Auth ---
@@ -21,9 +23,10 @@ type GHLoginResponse struct {
 // --- Tags ---
 
 type GHTag struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Color string `json:"color"`
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type GHTagWithCount struct {
@@ -36,6 +39,10 @@ type GHCreateTagRequest struct {
 	Color string `json:"color,omitempty"`
 }
 
+type GHUpdateTagRequest struct {
+	Name string `json:"name"`
+}
+
 // --- Studios ---
 
 type GHStudio struct {
@@ -70,21 +77,22 @@ type GHUpdateStudioRequest struct {
 // --- Actors ---
 
 type GHActor struct {
-	ID           uint    `json:"id"`
-	Name         string  `json:"name"`
-	Gender       string  `json:"gender"`
-	Birthday     *string `json:"birthday"`
-	DateOfDeath  *string `json:"date_of_death"`
-	Ethnicity    string  `json:"ethnicity"`
-	Nationality  string  `json:"nationality"`
-	HeightCm     *int    `json:"height_cm"`
-	WeightKg     *int    `json:"weight_kg"`
-	Measurements string  `json:"measurements"`
-	HairColor    string  `json:"hair_color"`
-	EyeColor     string  `json:"eye_color"`
-	Tattoos      string  `json:"tattoos"`
-	Piercings    string  `json:"piercings"`
-	FakeBoobs    bool    `json:"fake_boobs"`
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	Gender       string    `json:"gender"`
+	Birthday     *string   `json:"birthday"`
+	DateOfDeath  *string   `json:"date_of_death"`
+	Ethnicity    string    `json:"ethnicity"`
+	Nationality  string    `json:"nationality"`
+	HeightCm     *int      `json:"height_cm"`
+	WeightKg     *int      `json:"weight_kg"`
+	Measurements string    `json:"measurements"`
+	HairColor    string    `json:"hair_color"`
+	EyeColor     string    `json:"eye_color"`
+	Tattoos      string    `json:"tattoos"`
+	Piercings    string    `json:"piercings"`
+	FakeBoobs    bool      `json:"fake_boobs"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type GHActorListItem struct {
@@ -111,6 +119,49 @@ type GHCreateActorRequest struct {
 	FakeBoobs    bool    `json:"fake_boobs,omitempty"`
 }
 
+// GHUpdateActorRequest is a partial update; nil fields are left unchanged.
+type GHUpdateActorRequest struct {
+	Name         *string `json:"name,omitempty"`
+	Gender       *string `json:"gender,omitempty"`
+	Birthday     *string `json:"birthday,omitempty"`
+	DateOfDeath  *string `json:"date_of_death,omitempty"`
+	Ethnicity    *string `json:"ethnicity,omitempty"`
+	Nationality  *string `json:"nationality,omitempty"`
+	HeightCm     *int    `json:"height_cm,omitempty"`
+	WeightKg     *int    `json:"weight_kg,omitempty"`
+	Measurements *string `json:"measurements,omitempty"`
+	HairColor    *string `json:"hair_color,omitempty"`
+	EyeColor     *string `json:"eye_color,omitempty"`
+	Tattoos      *string `json:"tattoos,omitempty"`
+	Piercings    *string `json:"piercings,omitempty"`
+}
+
+// --- Scenes ---
+
+type GHScene struct {
+	ID            uint              `json:"id"`
+	Title         string            `json:"title"`
+	Description   string            `json:"description"`
+	ReleaseDate   *string           `json:"release_date"`
+	StudioID      *uint             `json:"studio_id"`
+	StoredPath    string            `json:"stored_path"`
+	StoragePathID *uint             `json:"storage_path_id"`
+	Origin        string            `json:"origin"`
+	Tags          []GHTag           `json:"tags"`
+	Actors        []GHActorListItem `json:"actors"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// GHUpdateSceneRequest is a partial update; nil fields are left unchanged.
+type GHUpdateSceneRequest struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	ReleaseDate *string `json:"release_date,omitempty"`
+
+	StoredPath    *string `json:"stored_path,omitempty"`
+	StoragePathID *uint   `json:"storage_path_id,omitempty"`
+}
+
 // --- Scenes (Import) ---
 
 type GHImportSceneRequest struct {
@@ -154,6 +205,50 @@ type GHImportMarkerResponse struct {
 	SceneID uint `json:"scene_id"`
 }
 
+// --- Storage paths ---
+
+// GHStoragePath is a library directory configured in GoonHub. Scene stored paths
+// live under one of them.
+type GHStoragePath struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	IsDefault bool   `json:"is_default"`
+}
+
+// --- Saved searches ---
+
+// GHSavedSearch is a named scene search ("smart playlist") that GoonHub
+// re-evaluates whenever it is opened.
+type GHSavedSearch struct {
+	ID      uint                 `json:"id"`
+	Name    string               `json:"name"`
+	Filters GHSavedSearchFilters `json:"filters"`
+}
+
+// GHSavedSearchFilters are the scene search options a saved search stores.
+// Ratings are on GoonHub's 0-5 scale; TagMatch and ActorMatch are "any" or "all".
+type GHSavedSearchFilters struct {
+	Query         string   `json:"query,omitempty"`
+	TagIDs        []uint   `json:"tag_ids,omitempty"`
+	TagMatch      string   `json:"tag_match,omitempty"`
+	ExcludeTagIDs []uint   `json:"exclude_tag_ids,omitempty"`
+	ActorIDs      []uint   `json:"actor_ids,omitempty"`
+	ActorMatch    string   `json:"actor_match,omitempty"`
+	StudioIDs     []uint   `json:"studio_ids,omitempty"`
+	MinRating     *float64 `json:"min_rating,omitempty"`
+	MaxRating     *float64 `json:"max_rating,omitempty"`
+	MinDate       string   `json:"min_date,omitempty"`
+	MaxDate       string   `json:"max_date,omitempty"`
+	MinHeight     int      `json:"min_height,omitempty"`
+	MaxHeight     int      `json:"max_height,omitempty"`
+}
+
+type GHCreateSavedSearchRequest struct {
+	Name    string               `json:"name"`
+	Filters GHSavedSearchFilters `json:"filters"`
+}
+
 // --- Associations ---
 
 type GHSetTagsRequest struct {
@@ -164,8 +259,9 @@ type GHSetActorsRequest struct {
 	ActorIDs []uint `json:"actor_ids"`
 }
 
+// GHSetStudioRequest sets a scene's studio; a nil StudioID (sent as null) clears it.
 type GHSetStudioRequest struct {
-	StudioID uint `json:"studio_id"`
+	StudioID *uint `json:"studio_id"`
 }
 
 type GHSetMarkerTagsRequest struct {
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func runHistory(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	phase := fs.String("phase", "", "only show entries of this phase (Tags, Studios, Actors, Scenes, Markers)")
+	action := fs.String("action", "", "only show entries with this action (created, mapped, associated, skipped, failed)")
+	sourceID := fs.String("source-id", "", "only show entries for this source ID")
+	failed := fs.Bool("errors", false, "only show failures (same as --action failed)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goonhub-stash-importer history [<run-id> [--phase P] [--action A] [--source-id ID] [--errors]]")
+		fmt.Fprintln(os.Stderr, "Dry runs are journaled too and listed as \"(dry run)\"; they only record skips and failures.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		listRuns(cfg)
+		return
+	}
+	runID := fs.Arg(0)
+	// Allow flags after the run ID too.
+	_ = fs.Parse(fs.Args()[1:])
+	if *failed {
+		*action = "failed"
+	}
+
+	entries, err := ReadJournal(cfg.RunsDir, runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "History error: %v\n", err)
+		os.Exit(1)
+	}
+
+	shown := 0
+	for _, e := range entries {
+		if *phase != "" && !strings.EqualFold(e.Phase, *phase) {
+			continue
+		}
+		if *action != "" && e.Action != *action {
+			continue
+		}
+		if *sourceID != "" && e.SourceID != *sourceID {
+			continue
+		}
+		fmt.Println(formatEntry(e))
+		shown++
+	}
+	fmt.Printf("\n%d of %d entries shown\n", shown, len(entries))
+}
+
+// listRuns prints one line per journaled run with its command and outcome.
+func listRuns(cfg *Config) {
+	ids, err := ListRuns(cfg.RunsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "History error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(ids) == 0 {
+		fmt.Printf("No runs journaled in %s\n", cfg.RunsDir)
+		return
+	}
+
+	fmt.Printf("%-18s  %-19s  %-7s  %-8s  %7s  %7s  %6s  %s\n",
+		"RUN", "STARTED", "COMMAND", "SOURCE", "CREATED", "SKIPPED", "ERRORS", "STATUS")
+	for _, id := range ids {
+		entries, err := ReadJournal(cfg.RunsDir, id)
+		if err != nil {
+			fmt.Printf("%-18s  %v\n", id, err)
+			continue
+		}
+
+		var started, command, source, status string
+		var total PhaseStats
+		dryRun := false
+		status = "incomplete"
+		for _, e := range entries {
+			switch e.Action {
+			case "started":
+				started = e.Time.Local().Format("2006-01-02 15:04:05")
+				command, source, dryRun = e.Command, e.Source, e.DryRun
+			case "created":
+				total.Created++
+			case "skipped":
+				total.Skipped++
+			case "failed":
+				total.Errors++
+			case "finished":
+				status = "done"
+			case "rolled_back":
+				status = "rolled back"
+			}
+		}
+		if dryRun {
+			status += " (dry run)"
+		}
+		fmt.Printf("%-18s  %-19s  %-7s  %-8s  %7d  %7d  %6d  %s\n",
+			id, started, command, source, total.Created, total.Skipped, total.Errors, status)
+	}
+}
+
+func formatEntry(e JournalEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-11s", e.Time.Local().Format("15:04:05"), e.Action)
+	if e.Phase != "" {
+		fmt.Fprintf(&b, " %-7s", singular(e.Phase))
+	}
+	if e.SourceID != "" {
+		fmt.Fprintf(&b, " %s", e.SourceID)
+	}
+	if e.GHID != 0 {
+		fmt.Fprintf(&b, " -> gh:%d", e.GHID)
+	}
+	switch {
+	case e.Command != "":
+		fmt.Fprintf(&b, " %s from %s", e.Command, e.Source)
+		if e.DryRun {
+			b.WriteString(" (dry run)")
+		}
+	case e.Field != "":
+		fmt.Fprintf(&b, " %s", e.Field)
+		if e.Previous != nil {
+			fmt.Fprintf(&b, " (was %d)", *e.Previous)
+		}
+	case e.Reason != "":
+		fmt.Fprintf(&b, " (%s)", e.Reason)
+	case e.Error != "":
+		fmt.Fprintf(&b, " ERROR: %s", e.Error)
+	}
+	if e.DurationMs > 0 {
+		fmt.Fprintf(&b, " [%dms]", e.DurationMs)
+	}
+	if e.RequestHash != "" {
+		fmt.Fprintf(&b, " req:%.12s", e.RequestHash)
+	}
+	return b.String()
+}
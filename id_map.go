@@ -2,72 +2,359 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
-// IDMap tracks Stash ID -> GoonHub ID mappings for idempotent imports.
+// IDMap tracks Stash ID -> GoonHub ID mappings for idempotent imports. It is
+// held in memory and persisted by the IDMapStore it was loaded from.
 type IDMap struct {
 	Tags    map[string]uint `json:"tags"`
 	Studios map[string]uint `json:"studios"`
 	Actors  map[string]uint `json:"actors"`
 	Scenes  map[string]uint `json:"scenes"`
 	Markers map[string]uint `json:"markers"`
+	// SavedSearches maps source saved filter IDs to GoonHub saved searches.
+	SavedSearches map[string]uint `json:"saved_searches"`
+
+	// RunID is the journaled run making changes, saved with each new or changed
+	// mapping by stores that keep per-entry metadata.
+	RunID string `json:"-"`
+
+	store      IDMapStore
+	keepHashes bool              // the store saves source hashes, see Note
+	hashes     map[string]string // "<phase>:<source id>" -> source entity hash
 }
 
 func NewIDMap() *IDMap {
-	return &IDMap{
-		Tags:    make(map[string]uint),
-		Studios: make(map[string]uint),
-		Actors:  make(map[string]uint),
-		Scenes:  make(map[string]uint),
-		Markers: make(map[string]uint),
+	m := &IDMap{}
+	m.init()
+	return m
+}
+
+// init makes sure all maps exist, e.g. after loading a file that lacks some.
+func (m *IDMap) init() {
+	for _, k := range []*map[string]uint{&m.Tags, &m.Studios, &m.Actors, &m.Scenes, &m.Markers, &m.SavedSearches} {
+		if *k == nil {
+			*k = make(map[string]uint)
+		}
+	}
+	if m.hashes == nil {
+		m.hashes = make(map[string]string)
 	}
 }
 
-// Load reads the ID map from a JSON file. Returns a new empty map if the file doesn't exist.
-func LoadIDMap(path string) (*IDMap, error) {
-	data, err := os.ReadFile(path)
+// idMapKind is one of the IDMap's maps, named as in id_map.json.
+type idMapKind struct {
+	Name  string
+	Phase string
+	IDs   map[string]uint
+}
+
+func (m *IDMap) kinds() []idMapKind {
+	return []idMapKind{
+		{"tags", "Tags", m.Tags},
+		{"studios", "Studios", m.Studios},
+		{"actors", "Actors", m.Actors},
+		{"scenes", "Scenes", m.Scenes},
+		{"markers", "Markers", m.Markers},
+		{"saved_searches", "Searches", m.SavedSearches},
+	}
+}
+
+// Len returns the number of mappings of all kinds.
+func (m *IDMap) Len() int {
+	n := 0
+	for _, k := range m.kinds() {
+		n += len(k.IDs)
+	}
+	return n
+}
+
+// Note records the source entity an import phase is working on, so stores with
+// per-entry metadata can save its hash with the mapping it produces. It does
+// nothing for stores that don't keep hashes.
+func (m *IDMap) Note(phase, sourceID string, entity any) {
+	if !m.keepHashes {
+		return
+	}
+	if hash, err := hashJSON(entity); err == nil {
+		m.hashes[phase+":"+sourceID] = hash
+	}
+}
+
+// sourceHash returns the hash Note recorded for a mapping, or "".
+func (m *IDMap) sourceHash(phase, sourceID string) string {
+	return m.hashes[phase+":"+sourceID]
+}
+
+// Save persists the map to the store it was loaded from. A map that wasn't
+// loaded from a store (NewIDMap) isn't saved.
+func (m *IDMap) Save() error {
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Save(m)
+}
+
+// IDMapStore persists an IDMap. Save is called with the IDMap the store loaded,
+// after every phase and at checkpoints within one.
+type IDMapStore interface {
+	Load() (*IDMap, error)
+	Save(m *IDMap) error
+	Close() error
+}
+
+// OpenIDMapStore opens the store selected by cfg.IDMapStore.
+func OpenIDMapStore(cfg *Config) (IDMapStore, error) {
+	switch cfg.IDMapStore {
+	case "sqlite":
+		return OpenSQLiteIDMapStore(cfg.IDMapDBFile)
+	default:
+		return &JSONIDMapStore{Path: cfg.IDMapFile}, nil
+	}
+}
+
+// idMapPath returns the file of the configured ID map store.
+func idMapPath(cfg *Config) string {
+	if cfg.IDMapStore == "sqlite" {
+		return cfg.IDMapDBFile
+	}
+	return cfg.IDMapFile
+}
+
+// JSONIDMapStore keeps the ID map in one JSON file (id_map.json), rewritten in
+// full on every save.
+type JSONIDMapStore struct {
+	Path string
+
+	backedUp bool // backups were rotated by this process
+}
+
+// Load reads the ID map from the JSON file. Returns a new empty map if the file
+// doesn't exist.
+func (s *JSONIDMapStore) Load() (*IDMap, error) {
+	idMap := NewIDMap()
+	idMap.store = s
+	data, err := os.ReadFile(s.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return NewIDMap(), nil
+			return idMap, nil
 		}
 		return nil, fmt.Errorf("failed to read id map: %w", err)
 	}
-
-	idMap := NewIDMap()
 	if err := json.Unmarshal(data, idMap); err != nil {
 		return nil, fmt.Errorf("failed to parse id map: %w", err)
 	}
+	idMap.init()
+	return idMap, nil
+}
+
+// idMapBackups is how many earlier versions of the ID map file are kept, as
+// <file>.1 (newest) to <file>.3.
+const idMapBackups = 3
+
+// Save writes the ID map to the JSON file. The file is replaced atomically: the
+// map is written and synced to a temporary file that is then renamed over it, so
+// a crash leaves either the old or the new map. The first save of a process
+// rotates the backups of the previous file.
+func (s *JSONIDMapStore) Save(m *IDMap) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal id map: %w", err)
+	}
+	if !s.backedUp {
+		if err := rotateBackups(s.Path, idMapBackups); err != nil {
+			return fmt.Errorf("failed to back up id map: %w", err)
+		}
+		s.backedUp = true
+	}
+	if err := writeFileAtomic(s.Path, data); err != nil {
+		return fmt.Errorf("failed to write id map: %w", err)
+	}
+	return nil
+}
 
-	// Ensure all maps are initialized even if absent in JSON
-	if idMap.Tags == nil {
-		idMap.Tags = make(map[string]uint)
+// Close does nothing: the JSON store keeps no file open.
+func (s *JSONIDMapStore) Close() error {
+	return nil
+}
+
+// writeFileAtomic replaces path with data via a synced temporary file in the
+// same directory.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
 	}
-	if idMap.Studios == nil {
-		idMap.Studios = make(map[string]uint)
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
 	}
-	if idMap.Actors == nil {
-		idMap.Actors = make(map[string]uint)
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
 	}
-	if idMap.Scenes == nil {
-		idMap.Scenes = make(map[string]uint)
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
 	}
-	if idMap.Markers == nil {
-		idMap.Markers = make(map[string]uint)
+	if err := tmp.Close(); err != nil {
+		return err
 	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Sync the directory so the rename itself survives a crash. Not every
+	// platform can open directories for that, so failures are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
 
-	return idMap, nil
+// rotateBackups shifts <path>.1 .. <path>.n-1 up by one and copies path to
+// <path>.1. Does nothing if path doesn't exist yet.
+func rotateBackups(path string, n int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for i := n - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFileAtomic(path+".1", data)
 }
 
-// Save writes the ID map to a JSON file.
-func (m *IDMap) Save(path string) error {
-	data, err := json.MarshalIndent(m, "", "  ")
+// IDMapLock is a lock file next to the ID map that keeps two importer processes
+// from using the same map. It records the owner's PID and host; a lock left by a
+// process on this host that is no longer running is taken over.
+type IDMapLock struct {
+	path string
+}
+
+type idMapLockInfo struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Command  string    `json:"command"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// LockIDMap acquires the lock for the ID map at path.
+func LockIDMap(path string) (*IDMapLock, error) {
+	lockPath := path + ".lock"
+	host, _ := os.Hostname()
+	info, err := json.Marshal(idMapLockInfo{PID: os.Getpid(), Host: host, Command: strings.Join(os.Args, " "), Acquired: time.Now()})
 	if err != nil {
-		return fmt.Errorf("failed to marshal id map: %w", err)
+		return nil, fmt.Errorf("failed to marshal id map lock: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write id map: %w", err)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, werr := f.Write(info)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("failed to write id map lock: %w", werr)
+			}
+			return &IDMapLock{path: lockPath}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create id map lock: %w", err)
+		}
+
+		var owner idMapLockInfo
+		data, _ := os.ReadFile(lockPath)
+		if json.Unmarshal(data, &owner) != nil || owner.Host != host || (owner.PID != os.Getpid() && processAlive(owner.PID)) {
+			return nil, fmt.Errorf("%s is in use by another importer (%s); if none is running, delete %s",
+				path, describeLock(owner), lockPath)
+		}
+		fmt.Printf("[IDMap]   Removing stale lock left by process %d (started %s)\n", owner.PID, owner.Acquired.Format(time.RFC3339))
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale id map lock: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire id map lock %s", lockPath)
+}
+
+// Release removes the lock file. A nil lock does nothing.
+func (l *IDMapLock) Release() {
+	if l == nil {
+		return
+	}
+	os.Remove(l.path)
+}
+
+func describeLock(owner idMapLockInfo) string {
+	if owner.PID == 0 {
+		return "unreadable lock file"
+	}
+	return fmt.Sprintf("pid %d on %s since %s: %s", owner.PID, owner.Host, owner.Acquired.Format(time.RFC3339), owner.Command)
+}
+
+// processAlive reports whether a process with the given PID is running. On Unix
+// signal 0 probes for it; on Windows FindProcess itself fails for a dead PID.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// invert returns a GoonHub ID -> Stash IDs lookup for one of the IDMap's maps.
+// Several Stash IDs share a GoonHub ID when the importer reused an entity by
+// name or merged tags; they're sorted so callers choose among them the same way
+// every run.
+func invert(m map[string]uint) map[uint][]string {
+	inv := make(map[uint][]string, len(m))
+	for stashID, ghID := range m {
+		inv[ghID] = append(inv[ghID], stashID)
+	}
+	for _, ids := range inv {
+		sort.Strings(ids)
+	}
+	return inv
+}
+
+// forPhase returns the map an import phase ("Tags", "Studios", ..., "Searches")
+// writes to, or nil.
+func (m *IDMap) forPhase(phase string) map[string]uint {
+	switch phase {
+	case "Tags":
+		return m.Tags
+	case "Studios":
+		return m.Studios
+	case "Actors":
+		return m.Actors
+	case "Scenes":
+		return m.Scenes
+	case "Markers":
+		return m.Markers
+	case "Searches":
+		return m.SavedSearches
 	}
 	return nil
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const idMapSchema = `
+CREATE TABLE IF NOT EXISTS id_map (
+	kind        TEXT    NOT NULL,
+	source_id   TEXT    NOT NULL,
+	gh_id       INTEGER NOT NULL,
+	created_at  TEXT    NOT NULL,
+	updated_at  TEXT    NOT NULL,
+	run_id      TEXT    NOT NULL DEFAULT '',
+	source_hash TEXT    NOT NULL DEFAULT '',
+	PRIMARY KEY (kind, source_id)
+)`
+
+// SQLiteIDMapStore keeps the ID map in a SQLite database (id_map.db), one row per
+// mapping with when it was created and last changed, the run that changed it and
+// the hash of the source entity it was made from. Saves write only the mappings
+// that changed since the last save, in one transaction.
+type SQLiteIDMapStore struct {
+	db *sql.DB
+
+	// saved is what the database holds, by kind name, to diff saves against.
+	saved map[string]map[string]uint
+}
+
+func OpenSQLiteIDMapStore(path string) (*SQLiteIDMapStore, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open id map database: %w", err)
+	}
+	if _, err := db.Exec(idMapSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create id map table: %w", err)
+	}
+	return &SQLiteIDMapStore{db: db, saved: make(map[string]map[string]uint)}, nil
+}
+
+func (s *SQLiteIDMapStore) Close() error {
+	return s.db.Close()
+}
+
+// Load reads every mapping from the database.
+func (s *SQLiteIDMapStore) Load() (*IDMap, error) {
+	idMap := NewIDMap()
+	idMap.store = s
+	idMap.keepHashes = true
+	byName := make(map[string]map[string]uint)
+	for _, k := range idMap.kinds() {
+		byName[k.Name] = k.IDs
+	}
+
+	rows, err := s.db.Query("SELECT kind, source_id, gh_id FROM id_map")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read id map: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, sourceID string
+		var ghID uint
+		if err := rows.Scan(&kind, &sourceID, &ghID); err != nil {
+			return nil, fmt.Errorf("failed to read id map: %w", err)
+		}
+		ids, ok := byName[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q in id map database", kind)
+		}
+		ids[sourceID] = ghID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read id map: %w", err)
+	}
+
+	for _, k := range idMap.kinds() {
+		s.saved[k.Name] = copyIDs(k.IDs)
+	}
+	return idMap, nil
+}
+
+// Save writes the mappings that were added, changed or removed since the last
+// Load or Save.
+func (s *SQLiteIDMapStore) Save(m *IDMap) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save id map: %w", err)
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(`INSERT INTO id_map (kind, source_id, gh_id, created_at, updated_at, run_id, source_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (kind, source_id) DO UPDATE SET
+			gh_id = excluded.gh_id, updated_at = excluded.updated_at,
+			run_id = excluded.run_id, source_hash = excluded.source_hash`)
+	if err != nil {
+		return fmt.Errorf("failed to save id map: %w", err)
+	}
+	defer upsert.Close()
+	remove, err := tx.Prepare("DELETE FROM id_map WHERE kind = ? AND source_id = ?")
+	if err != nil {
+		return fmt.Errorf("failed to save id map: %w", err)
+	}
+	defer remove.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	type change struct {
+		kind, sourceID string
+		ghID           uint
+		removed        bool
+	}
+	var changes []change
+	for _, k := range m.kinds() {
+		saved := s.saved[k.Name]
+		for sourceID, ghID := range k.IDs {
+			if old, ok := saved[sourceID]; ok && old == ghID {
+				continue
+			}
+			if _, err := upsert.Exec(k.Name, sourceID, ghID, now, now, m.RunID, m.sourceHash(k.Phase, sourceID)); err != nil {
+				return fmt.Errorf("failed to save id map: %w", err)
+			}
+			changes = append(changes, change{kind: k.Name, sourceID: sourceID, ghID: ghID})
+		}
+		for sourceID := range saved {
+			if _, ok := k.IDs[sourceID]; ok {
+				continue
+			}
+			if _, err := remove.Exec(k.Name, sourceID); err != nil {
+				return fmt.Errorf("failed to save id map: %w", err)
+			}
+			changes = append(changes, change{kind: k.Name, sourceID: sourceID, removed: true})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save id map: %w", err)
+	}
+
+	for _, c := range changes {
+		if s.saved[c.kind] == nil {
+			s.saved[c.kind] = make(map[string]uint)
+		}
+		if c.removed {
+			delete(s.saved[c.kind], c.sourceID)
+		} else {
+			s.saved[c.kind][c.sourceID] = c.ghID
+		}
+	}
+	return nil
+}
+
+// Count returns the number of mappings in the database.
+func (s *SQLiteIDMapStore) Count() (int, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM id_map").Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count id map entries: %w", err)
+	}
+	return n, nil
+}
+
+func copyIDs(ids map[string]uint) map[string]uint {
+	out := make(map[string]uint, len(ids))
+	for k, v := range ids {
+		out[k] = v
+	}
+	return out
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"strings"
+	"time"
 )
 
 type Importer struct {
-	stash      *StashClient
+	source     Source
 	gh         *GoonHubClient
 	idMap      *IDMap
 	pathMapper *PathMapper
@@ -17,17 +19,60 @@ type Importer struct {
 	ghTags    map[string]uint // name -> id
 	ghStudios map[string]uint // name -> id
 	ghActors  map[string]uint // name -> id
+
+	// plan, when set, records every decision instead of writing to GoonHub.
+	// planned tracks entities the plan will create ("<phase>:<source id>") so
+	// later phases can refer to them.
+	plan    *ImportPlan
+	planned map[string]bool
+	// applied tracks entities ApplyPlan created ("<phase>:<source id>"); link
+	// steps only touch those.
+	applied map[string]bool
+
+	// journal records what this run changed so it can be rolled back.
+	journal *RunJournal
+	// failures tracks entities that failed, for retry-failed.
+	failures *FailureList
+	// scope selects which phases run; nil runs all of them.
+	scope *ImportScope
+	// tagRules rename, merge and drop source tags; tags applies them to the
+	// source's tags (see resolveTags). A nil tags passes tags through unchanged.
+	tagRules *TagRules
+	tags     *tagResolver
+	// transforms rewrite request fields before they're sent.
+	transforms *Transforms
+	// parser fills in untitled scenes from their file names as they're fetched.
+	parser *FilenameParser
+	// files verifies scene files locally before import; nil when VERIFY_FILES is unset.
+	files *FileChecker
+	// sinceSave and lastSave pace the ID map checkpoints inside phases.
+	sinceSave int
+	lastSave  time.Time
 }
 
 type PhaseStats struct {
-	Created int
-	Skipped int
-	Errors  int
+	Created int `json:"created"`
+	Updated int `json:"updated,omitempty"`
+	Deleted int `json:"deleted,omitempty"`
+	Skipped int `json:"skipped"`
+	Errors  int `json:"errors"`
+}
+
+// failed records an entity that couldn't be imported in the journal and failure list.
+func (imp *Importer) failed(phase, sourceID string, err error) {
+	imp.journal.Failed(phase, sourceID, err)
+	imp.failures.Failed(phase, sourceID, err)
 }
 
-func NewImporter(stash *StashClient, gh *GoonHubClient, idMap *IDMap, pathMapper *PathMapper, cfg *Config) *Importer {
+// skipped records an entity that was deliberately left alone; it no longer needs retrying.
+func (imp *Importer) skipped(phase, sourceID string, ghID uint, reason string) {
+	imp.journal.Skipped(phase, sourceID, ghID, reason)
+	imp.failures.Resolved(phase, sourceID)
+}
+
+func NewImporter(source Source, gh *GoonHubClient, idMap *IDMap, pathMapper *PathMapper, cfg *Config) *Importer {
 	return &Importer{
-		stash:      stash,
+		source:     source,
 		gh:         gh,
 		idMap:      idMap,
 		pathMapper: pathMapper,
@@ -35,6 +80,9 @@ func NewImporter(stash *StashClient, gh *GoonHubClient, idMap *IDMap, pathMapper
 		ghTags:     make(map[string]uint),
 		ghStudios:  make(map[string]uint),
 		ghActors:   make(map[string]uint),
+		planned:    make(map[string]bool),
+		files:      NewFileChecker(cfg),
+		lastSave:   time.Now(),
 	}
 }
 
@@ -73,50 +121,95 @@ func (imp *Importer) PreFetchExisting() error {
 }
 
 // Phase 1: Import Tags
-func (imp *Importer) ImportTags(stashTags []StashTag) PhaseStats {
+func (imp *Importer) ImportTags(tags []SourceTag) PhaseStats {
 	stats := PhaseStats{}
-	total := len(stashTags)
+	total := len(tags)
 	fmt.Printf("\n[Tags]    Importing %d tags...\n", total)
 
-	for i, tag := range stashTags {
+	for i, tag := range tags {
+		imp.journal.Begin()
 		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		imp.idMap.Note("Tags", tag.ID, tag)
+
+		// Tag rules: dropped and merged-away tags aren't imported themselves
+		canon, keep := imp.tags.resolve(tag.ID)
+		if !keep {
+			imp.record(PlanStep{Phase: "Tags", Action: "skip", SourceID: tag.ID, Label: tag.Name, Reason: "dropped by tag rules"})
+			fmt.Printf("[Tags]    %s Dropped %q (tag rules)\n", idx, tag.Name)
+			imp.skipped("Tags", tag.ID, 0, "dropped by tag rules")
+			stats.Skipped++
+			continue
+		}
+		if canon != tag.ID {
+			reason := fmt.Sprintf("merged into %s", canon)
+			imp.record(PlanStep{Phase: "Tags", Action: "skip", SourceID: tag.ID, Label: tag.Name, Reason: reason})
+			fmt.Printf("[Tags]    %s Merged %q into %q (tag rules)\n", idx, tag.Name, imp.tags.names[canon])
+			imp.skipped("Tags", tag.ID, 0, reason)
+			stats.Skipped++
+			continue
+		}
+		name := imp.tags.name(tag)
 
 		// Already mapped
-		if _, ok := imp.idMap.Tags[tag.ID]; ok {
-			fmt.Printf("[Tags]    %s Skipped %q (already mapped)\n", idx, tag.Name)
+		if ghID, ok := imp.idMap.Tags[tag.ID]; ok {
+			imp.record(PlanStep{Phase: "Tags", Action: "skip", SourceID: tag.ID, Label: name, GHID: ghID, Reason: "already mapped"})
+			fmt.Printf("[Tags]    %s Skipped %q (already mapped)\n", idx, name)
+			imp.skipped("Tags", tag.ID, ghID, "already mapped")
 			stats.Skipped++
 			continue
 		}
 
+		req := GHCreateTagRequest{Name: name}
+		if err := imp.transforms.Apply("Tags", &req, tag); err != nil {
+			fmt.Printf("[Tags]    %s ERROR transforming %q: %v\n", idx, name, err)
+			imp.failed("Tags", tag.ID, err)
+			stats.Errors++
+			continue
+		}
+		name = req.Name
+
 		// Check existing by name
-		if ghID, ok := imp.ghTags[strings.ToLower(tag.Name)]; ok {
+		if ghID, ok := imp.ghTags[strings.ToLower(name)]; ok {
 			imp.idMap.Tags[tag.ID] = ghID
-			fmt.Printf("[Tags]    %s Reused %q (existing gh:%d)\n", idx, tag.Name, ghID)
+			imp.journal.Mapped("Tags", tag.ID, ghID)
+			imp.record(PlanStep{Phase: "Tags", Action: "reuse", SourceID: tag.ID, Label: name, GHID: ghID, Reason: "existing tag with the same name"})
+			fmt.Printf("[Tags]    %s Reused %q (existing gh:%d)\n", idx, name, ghID)
 			stats.Skipped++
 			continue
 		}
 
-		if imp.cfg.DryRun {
-			fmt.Printf("[Tags]    %s [DRY RUN] Would create %q\n", idx, tag.Name)
+		if imp.dryRun() {
+			if err := imp.recordCreate("Tags", tag.ID, name, req, nil); err != nil {
+				fmt.Printf("[Tags]    %s ERROR planning %q: %v\n", idx, name, err)
+				imp.failed("Tags", tag.ID, err)
+				stats.Errors++
+				continue
+			}
+			fmt.Printf("[Tags]    %s [DRY RUN] Would create %q\n", idx, name)
 			stats.Created++
 			continue
 		}
 
-		created, err := imp.gh.CreateTag(tag.Name, "")
+		imp.journal.Request(req)
+		created, err := imp.gh.CreateTag(req.Name, req.Color)
 		if err != nil {
 			if isConflict(err) {
-				fmt.Printf("[Tags]    %s Skipped %q (conflict/already exists)\n", idx, tag.Name)
+				fmt.Printf("[Tags]    %s Skipped %q (conflict/already exists)\n", idx, name)
+				imp.skipped("Tags", tag.ID, 0, "conflict/already exists")
 				stats.Skipped++
 				continue
 			}
-			fmt.Printf("[Tags]    %s ERROR creating %q: %v\n", idx, tag.Name, err)
+			fmt.Printf("[Tags]    %s ERROR creating %q: %v\n", idx, name, err)
+			imp.failed("Tags", tag.ID, err)
 			stats.Errors++
 			continue
 		}
 
 		imp.idMap.Tags[tag.ID] = created.ID
-		imp.ghTags[strings.ToLower(tag.Name)] = created.ID
-		fmt.Printf("[Tags]    %s Created %q (stash:%s -> gh:%d)\n", idx, tag.Name, tag.ID, created.ID)
+		imp.journal.Created("Tags", tag.ID, created.ID)
+		imp.ghTags[strings.ToLower(name)] = created.ID
+		fmt.Printf("[Tags]    %s Created %q (%s -> gh:%d)\n", idx, name, imp.sourceRef(tag.ID), created.ID)
 		stats.Created++
 	}
 
@@ -125,34 +218,26 @@ func (imp *Importer) ImportTags(stashTags []StashTag) PhaseStats {
 }
 
 // Phase 2: Import Studios
-func (imp *Importer) ImportStudios(stashStudios []StashStudio) PhaseStats {
+func (imp *Importer) ImportStudios(studios []SourceStudio) PhaseStats {
 	stats := PhaseStats{}
-	total := len(stashStudios)
+	total := len(studios)
 	fmt.Printf("\n[Studios] Importing %d studios...\n", total)
 
 	// First pass: create all studios without parent
-	for i, studio := range stashStudios {
+	for i, studio := range studios {
+		imp.journal.Begin()
 		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		imp.idMap.Note("Studios", studio.ID, studio)
 
-		if _, ok := imp.idMap.Studios[studio.ID]; ok {
+		if ghID, ok := imp.idMap.Studios[studio.ID]; ok {
+			imp.record(PlanStep{Phase: "Studios", Action: "skip", SourceID: studio.ID, Label: studio.Name, GHID: ghID, Reason: "already mapped"})
 			fmt.Printf("[Studios] %s Skipped %q (already mapped)\n", idx, studio.Name)
+			imp.skipped("Studios", studio.ID, ghID, "already mapped")
 			stats.Skipped++
 			continue
 		}
 
-		if ghID, ok := imp.ghStudios[strings.ToLower(studio.Name)]; ok {
-			imp.idMap.Studios[studio.ID] = ghID
-			fmt.Printf("[Studios] %s Reused %q (existing gh:%d)\n", idx, studio.Name, ghID)
-			stats.Skipped++
-			continue
-		}
-
-		if imp.cfg.DryRun {
-			fmt.Printf("[Studios] %s [DRY RUN] Would create %q\n", idx, studio.Name)
-			stats.Created++
-			continue
-		}
-
 		req := GHCreateStudioRequest{
 			Name:        studio.Name,
 			Description: studio.Details,
@@ -165,48 +250,83 @@ func (imp *Importer) ImportStudios(stashStudios []StashStudio) PhaseStats {
 			req.Rating = &r
 		}
 
+		if err := imp.transforms.Apply("Studios", &req, studio); err != nil {
+			fmt.Printf("[Studios] %s ERROR transforming %q: %v\n", idx, studio.Name, err)
+			imp.failed("Studios", studio.ID, err)
+			stats.Errors++
+			continue
+		}
+		name := req.Name
+
+		if ghID, ok := imp.ghStudios[strings.ToLower(name)]; ok {
+			imp.idMap.Studios[studio.ID] = ghID
+			imp.journal.Mapped("Studios", studio.ID, ghID)
+			imp.record(PlanStep{Phase: "Studios", Action: "reuse", SourceID: studio.ID, Label: name, GHID: ghID, Reason: "existing studio with the same name"})
+			fmt.Printf("[Studios] %s Reused %q (existing gh:%d)\n", idx, name, ghID)
+			stats.Skipped++
+			continue
+		}
+
+		if imp.dryRun() {
+			if err := imp.recordCreate("Studios", studio.ID, name, req, nil); err != nil {
+				fmt.Printf("[Studios] %s ERROR planning %q: %v\n", idx, name, err)
+				imp.failed("Studios", studio.ID, err)
+				stats.Errors++
+				continue
+			}
+			fmt.Printf("[Studios] %s [DRY RUN] Would create %q\n", idx, name)
+			stats.Created++
+			continue
+		}
+
+		imp.journal.Request(req)
 		created, err := imp.gh.CreateStudio(req)
 		if err != nil {
 			if isConflict(err) {
-				fmt.Printf("[Studios] %s Skipped %q (conflict/already exists)\n", idx, studio.Name)
+				fmt.Printf("[Studios] %s Skipped %q (conflict/already exists)\n", idx, name)
+				imp.skipped("Studios", studio.ID, 0, "conflict/already exists")
 				stats.Skipped++
 				continue
 			}
-			fmt.Printf("[Studios] %s ERROR creating %q: %v\n", idx, studio.Name, err)
+			fmt.Printf("[Studios] %s ERROR creating %q: %v\n", idx, name, err)
+			imp.failed("Studios", studio.ID, err)
 			stats.Errors++
 			continue
 		}
 
 		imp.idMap.Studios[studio.ID] = created.ID
-		imp.ghStudios[strings.ToLower(studio.Name)] = created.ID
-		fmt.Printf("[Studios] %s Created %q (stash:%s -> gh:%d)\n", idx, studio.Name, studio.ID, created.ID)
+		imp.journal.Created("Studios", studio.ID, created.ID)
+		imp.ghStudios[strings.ToLower(name)] = created.ID
+		fmt.Printf("[Studios] %s Created %q (%s -> gh:%d)\n", idx, name, imp.sourceRef(studio.ID), created.ID)
 		stats.Created++
 	}
 
 	// Second pass: set parent relationships
 	parentCount := 0
-	for _, studio := range stashStudios {
-		if studio.ParentStudio == nil {
+	for _, studio := range studios {
+		if studio.ParentID == "" {
 			continue
 		}
 
 		ghID, ok := imp.idMap.Studios[studio.ID]
-		if !ok {
+		if !ok && !imp.planned["Studios:"+studio.ID] {
 			continue
 		}
-		parentGHID, ok := imp.idMap.Studios[studio.ParentStudio.ID]
-		if !ok {
-			fmt.Printf("[Studios] WARNING: parent studio stash:%s not mapped for %q\n", studio.ParentStudio.ID, studio.Name)
+		parentGHID, ok := imp.idMap.Studios[studio.ParentID]
+		if !ok && !imp.planned["Studios:"+studio.ParentID] {
+			fmt.Printf("[Studios] WARNING: parent studio %s not mapped for %q\n", imp.sourceRef(studio.ParentID), studio.Name)
 			continue
 		}
 
-		if imp.cfg.DryRun {
-			fmt.Printf("[Studios] [DRY RUN] Would set parent of %q to gh:%d\n", studio.Name, parentGHID)
+		if imp.dryRun() {
+			imp.record(PlanStep{Phase: "Studios", Action: "update", SourceID: studio.ID, Label: studio.Name,
+				Reason: "set parent studio", Refs: map[string][]string{"parent": {studio.ParentID}}})
+			fmt.Printf("[Studios] [DRY RUN] Would set parent of %q to %s\n", studio.Name, imp.sourceRef(studio.ParentID))
 			parentCount++
 			continue
 		}
 
-		if err := imp.gh.UpdateStudio(ghID, GHUpdateStudioRequest{ParentID: &parentGHID}); err != nil {
+		if err := imp.setStudioParent(studio.ID, ghID, parentGHID); err != nil {
 			fmt.Printf("[Studios] WARNING: failed to set parent for %q: %v\n", studio.Name, err)
 			continue
 		}
@@ -221,67 +341,74 @@ func (imp *Importer) ImportStudios(stashStudios []StashStudio) PhaseStats {
 }
 
 // Phase 3: Import Performers -> Actors
-func (imp *Importer) ImportPerformers(stashPerformers []StashPerformer) PhaseStats {
+func (imp *Importer) ImportPerformers(performers []SourcePerformer) PhaseStats {
 	stats := PhaseStats{}
-	total := len(stashPerformers)
+	total := len(performers)
 	fmt.Printf("\n[Actors]  Importing %d performers...\n", total)
 
-	for i, perf := range stashPerformers {
+	for i, perf := range performers {
+		imp.journal.Begin()
 		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		imp.idMap.Note("Actors", perf.ID, perf)
 
-		if _, ok := imp.idMap.Actors[perf.ID]; ok {
+		if ghID, ok := imp.idMap.Actors[perf.ID]; ok {
+			imp.record(PlanStep{Phase: "Actors", Action: "skip", SourceID: perf.ID, Label: perf.Name, GHID: ghID, Reason: "already mapped"})
 			fmt.Printf("[Actors]  %s Skipped %q (already mapped)\n", idx, perf.Name)
+			imp.skipped("Actors", perf.ID, ghID, "already mapped")
 			stats.Skipped++
 			continue
 		}
 
-		if ghID, ok := imp.ghActors[strings.ToLower(perf.Name)]; ok {
+		req := actorRequest(perf)
+		if err := imp.transforms.Apply("Actors", &req, perf); err != nil {
+			fmt.Printf("[Actors]  %s ERROR transforming %q: %v\n", idx, perf.Name, err)
+			imp.failed("Actors", perf.ID, err)
+			stats.Errors++
+			continue
+		}
+		name := req.Name
+
+		if ghID, ok := imp.ghActors[strings.ToLower(name)]; ok {
 			imp.idMap.Actors[perf.ID] = ghID
-			fmt.Printf("[Actors]  %s Reused %q (existing gh:%d)\n", idx, perf.Name, ghID)
+			imp.journal.Mapped("Actors", perf.ID, ghID)
+			imp.record(PlanStep{Phase: "Actors", Action: "reuse", SourceID: perf.ID, Label: name, GHID: ghID, Reason: "existing actor with the same name"})
+			fmt.Printf("[Actors]  %s Reused %q (existing gh:%d)\n", idx, name, ghID)
 			stats.Skipped++
 			continue
 		}
 
-		if imp.cfg.DryRun {
-			fmt.Printf("[Actors]  %s [DRY RUN] Would create %q\n", idx, perf.Name)
+		if imp.dryRun() {
+			if err := imp.recordCreate("Actors", perf.ID, name, req, nil); err != nil {
+				fmt.Printf("[Actors]  %s ERROR planning %q: %v\n", idx, name, err)
+				imp.failed("Actors", perf.ID, err)
+				stats.Errors++
+				continue
+			}
+			fmt.Printf("[Actors]  %s [DRY RUN] Would create %q\n", idx, name)
 			stats.Created++
 			continue
 		}
 
-		req := GHCreateActorRequest{
-			Name:         perf.Name,
-			Gender:       mapGender(perf.Gender),
-			Ethnicity:    derefStr(perf.Ethnicity),
-			Nationality:  derefStr(perf.Country),
-			HeightCm:     perf.HeightCm,
-			Measurements: derefStr(perf.Measurements),
-			HairColor:    derefStr(perf.HairColor),
-			EyeColor:     derefStr(perf.EyeColor),
-			Tattoos:      derefStr(perf.Tattoos),
-			Piercings:    derefStr(perf.Piercings),
-			FakeBoobs:    isFakeBoobs(perf.FakeTits),
-			Birthday:     perf.Birthdate,
-			DateOfDeath:  perf.DeathDate,
-		}
-		if perf.Weight != nil {
-			req.WeightKg = perf.Weight
-		}
-
+		imp.journal.Request(req)
 		created, err := imp.gh.CreateActor(req)
 		if err != nil {
 			if isConflict(err) {
-				fmt.Printf("[Actors]  %s Skipped %q (conflict/already exists)\n", idx, perf.Name)
+				fmt.Printf("[Actors]  %s Skipped %q (conflict/already exists)\n", idx, name)
+				imp.skipped("Actors", perf.ID, 0, "conflict/already exists")
 				stats.Skipped++
 				continue
 			}
-			fmt.Printf("[Actors]  %s ERROR creating %q: %v\n", idx, perf.Name, err)
+			fmt.Printf("[Actors]  %s ERROR creating %q: %v\n", idx, name, err)
+			imp.failed("Actors", perf.ID, err)
 			stats.Errors++
 			continue
 		}
 
 		imp.idMap.Actors[perf.ID] = created.ID
-		imp.ghActors[strings.ToLower(perf.Name)] = created.ID
-		fmt.Printf("[Actors]  %s Created %q (stash:%s -> gh:%d)\n", idx, perf.Name, perf.ID, created.ID)
+		imp.journal.Created("Actors", perf.ID, created.ID)
+		imp.ghActors[strings.ToLower(name)] = created.ID
+		fmt.Printf("[Actors]  %s Created %q (%s -> gh:%d)\n", idx, name, imp.sourceRef(perf.ID), created.ID)
 		stats.Created++
 	}
 
@@ -290,22 +417,29 @@ func (imp *Importer) ImportPerformers(stashPerformers []StashPerformer) PhaseSta
 }
 
 // Phase 4: Import Scenes
-func (imp *Importer) ImportScenes(stashScenes []StashScene) PhaseStats {
+func (imp *Importer) ImportScenes(scenes []SourceScene) PhaseStats {
 	stats := PhaseStats{}
-	total := len(stashScenes)
+	total := len(scenes)
 	fmt.Printf("\n[Scenes]  Importing %d scenes...\n", total)
 
-	for i, scene := range stashScenes {
+	for i, scene := range scenes {
+		imp.journal.Begin()
 		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		imp.idMap.Note("Scenes", scene.ID, scene)
 
-		if _, ok := imp.idMap.Scenes[scene.ID]; ok {
+		if ghID, ok := imp.idMap.Scenes[scene.ID]; ok {
+			imp.record(PlanStep{Phase: "Scenes", Action: "skip", SourceID: scene.ID, Label: scene.Title, GHID: ghID, Reason: "already mapped"})
 			fmt.Printf("[Scenes]  %s Skipped scene %s (already mapped)\n", idx, scene.ID)
+			imp.skipped("Scenes", scene.ID, ghID, "already mapped")
 			stats.Skipped++
 			continue
 		}
 
 		if len(scene.Files) == 0 {
+			imp.record(PlanStep{Phase: "Scenes", Action: "skip", SourceID: scene.ID, Label: scene.Title, Reason: "no files"})
 			fmt.Printf("[Scenes]  %s WARNING: scene %s has no files, skipping\n", idx, scene.ID)
+			imp.failed("Scenes", scene.ID, errors.New("no files"))
 			stats.Errors++
 			continue
 		}
@@ -314,39 +448,25 @@ func (imp *Importer) ImportScenes(stashScenes []StashScene) PhaseStats {
 
 		mapped, err := imp.pathMapper.MapPath(file.Path)
 		if err != nil {
+			imp.record(PlanStep{Phase: "Scenes", Action: "skip", SourceID: scene.ID, Label: scene.Title, Reason: err.Error()})
 			fmt.Printf("[Scenes]  %s WARNING: %v, skipping scene %s\n", idx, err, scene.ID)
+			imp.failed("Scenes", scene.ID, err)
 			stats.Errors++
 			continue
 		}
 
-		title := derefStr(scene.Title)
-		if title == "" {
-			title = file.Basename
-		}
-
-		if imp.cfg.DryRun {
-			fmt.Printf("[Scenes]  %s [DRY RUN] Would import %q (%s)\n", idx, title, file.Path)
-			stats.Created++
+		if err := imp.files.Check(scene.ID, file, mapped.GoonHubPath); err != nil {
+			imp.record(PlanStep{Phase: "Scenes", Action: "skip", SourceID: scene.ID, Label: scene.Title, Reason: err.Error()})
+			fmt.Printf("[Scenes]  %s WARNING: %v, skipping scene %s\n", idx, err, scene.ID)
+			imp.failed("Scenes", scene.ID, err)
+			stats.Errors++
 			continue
 		}
 
-		req := GHImportSceneRequest{
-			Title:            title,
-			StoredPath:       mapped.GoonHubPath,
-			OriginalFilename: file.Basename,
-			Size:             file.Size,
-			Duration:         int(math.Round(file.Duration)),
-			Width:            file.Width,
-			Height:           file.Height,
-			FrameRate:        file.FrameRate,
-			BitRate:          file.BitRate,
-			VideoCodec:       file.VideoCodec,
-			AudioCodec:       file.AudioCodec,
-			Description:      derefStr(scene.Details),
-			ReleaseDate:      scene.Date,
-			Origin:           "stash",
-			SkipFileCheck:    imp.cfg.SkipFileCheck,
-		}
+		req := sceneRequest(scene, file, imp.source.Name())
+		req.StoredPath = mapped.GoonHubPath
+		req.SkipFileCheck = imp.cfg.SkipFileCheck
+		title := req.Title
 
 		if mapped.StoragePathID > 0 {
 			spID := mapped.StoragePathID
@@ -354,187 +474,441 @@ func (imp *Importer) ImportScenes(stashScenes []StashScene) PhaseStats {
 		}
 
 		// Map studio
-		if scene.Studio != nil {
-			if ghStudioID, ok := imp.idMap.Studios[scene.Studio.ID]; ok {
+		if scene.StudioID != "" {
+			if ghStudioID, ok := imp.idMap.Studios[scene.StudioID]; ok {
 				req.StudioID = &ghStudioID
 			}
 		}
 
+		if err := imp.transforms.Apply("Scenes", &req, scene); err != nil {
+			imp.record(PlanStep{Phase: "Scenes", Action: "skip", SourceID: scene.ID, Label: title, Reason: err.Error()})
+			fmt.Printf("[Scenes]  %s ERROR transforming scene %s: %v\n", idx, scene.ID, err)
+			imp.failed("Scenes", scene.ID, err)
+			stats.Errors++
+			continue
+		}
+		title = req.Title
+
+		if imp.dryRun() {
+			refs := map[string][]string{}
+			if scene.StudioID != "" {
+				refs["studio"] = []string{scene.StudioID}
+			}
+			if err := imp.recordCreate("Scenes", scene.ID, title, req, refs); err != nil {
+				fmt.Printf("[Scenes]  %s ERROR planning %q: %v\n", idx, title, err)
+				imp.failed("Scenes", scene.ID, err)
+				stats.Errors++
+				continue
+			}
+			if len(scene.TagIDs) > 0 {
+				imp.record(PlanStep{Phase: "Scenes", Action: "link", SourceID: scene.ID, Label: title, Reason: "set scene tags",
+					Refs: map[string][]string{"tags": scene.TagIDs}})
+			}
+			if len(scene.PerformerIDs) > 0 {
+				imp.record(PlanStep{Phase: "Scenes", Action: "link", SourceID: scene.ID, Label: title, Reason: "set scene actors",
+					Refs: map[string][]string{"actors": scene.PerformerIDs}})
+			}
+			fmt.Printf("[Scenes]  %s [DRY RUN] Would import %q (%s)\n", idx, title, file.Path)
+			stats.Created++
+			continue
+		}
+
+		imp.journal.Request(req)
 		created, err := imp.gh.ImportScene(req)
 		if err != nil {
-			if conflictErr, ok := err.(*ConflictError); ok {
+			var conflictErr *ConflictError
+			if errors.As(err, &conflictErr) {
 				if conflictErr.ExistingID > 0 {
 					imp.idMap.Scenes[scene.ID] = conflictErr.ExistingID
+					imp.journal.Mapped("Scenes", scene.ID, conflictErr.ExistingID)
 					fmt.Printf("[Scenes]  %s Skipped %q (already exists as gh:%d)\n", idx, title, conflictErr.ExistingID)
 				} else {
 					fmt.Printf("[Scenes]  %s Skipped %q (conflict/already exists)\n", idx, title)
 				}
+				imp.skipped("Scenes", scene.ID, 0, "conflict/already exists")
 				stats.Skipped++
 				continue
 			}
 			fmt.Printf("[Scenes]  %s ERROR importing %q: %v\n", idx, title, err)
+			imp.failed("Scenes", scene.ID, err)
 			stats.Errors++
 			continue
 		}
 
 		imp.idMap.Scenes[scene.ID] = created.ID
-		fmt.Printf("[Scenes]  %s Created %q (stash:%s -> gh:%d)\n", idx, title, scene.ID, created.ID)
+		imp.journal.Created("Scenes", scene.ID, created.ID)
+		fmt.Printf("[Scenes]  %s Created %q (%s -> gh:%d)\n", idx, title, imp.sourceRef(scene.ID), created.ID)
 		stats.Created++
 
 		// Set tags
-		tagIDs := imp.mapTagIDs(scene.Tags)
+		tagIDs := imp.mapTagIDs(scene.TagIDs)
 		if len(tagIDs) > 0 {
 			if err := imp.gh.SetSceneTags(created.ID, tagIDs); err != nil {
 				fmt.Printf("[Scenes]  %s WARNING: failed to set tags: %v\n", idx, err)
+			} else {
+				imp.journal.Associated("Scenes", scene.ID, created.ID, "tags", nil)
 			}
 		}
 
 		// Set actors
-		actorIDs := imp.mapActorIDs(scene.Performers)
+		actorIDs := imp.mapActorIDs(scene.PerformerIDs)
 		if len(actorIDs) > 0 {
 			if err := imp.gh.SetSceneActors(created.ID, actorIDs); err != nil {
 				fmt.Printf("[Scenes]  %s WARNING: failed to set actors: %v\n", idx, err)
+			} else {
+				imp.journal.Associated("Scenes", scene.ID, created.ID, "actors", nil)
 			}
 		}
 	}
 
+	imp.files.Report()
 	printStats("Scenes", stats)
 	return stats
 }
 
 // Phase 5: Import Markers
-func (imp *Importer) ImportMarkers(stashScenes []StashScene) PhaseStats {
+func (imp *Importer) ImportMarkers(markers []SourceMarker) PhaseStats {
 	stats := PhaseStats{}
-
-	// Count total markers
-	totalMarkers := 0
-	for _, scene := range stashScenes {
-		totalMarkers += len(scene.SceneMarkers)
-	}
+	totalMarkers := len(markers)
 	fmt.Printf("\n[Markers] Importing %d markers...\n", totalMarkers)
 
-	markerNum := 0
-	for _, scene := range stashScenes {
-		ghSceneID, ok := imp.idMap.Scenes[scene.ID]
-		if !ok {
+	for i, marker := range markers {
+		imp.journal.Begin()
+		idx := fmt.Sprintf("[%*d/%d]", digits(totalMarkers), i+1, totalMarkers)
+		imp.checkpoint()
+		imp.idMap.Note("Markers", marker.ID, marker)
+
+		ghSceneID, ok := imp.idMap.Scenes[marker.SceneID]
+		if !ok && !imp.planned["Scenes:"+marker.SceneID] {
 			// Scene wasn't imported, skip its markers
-			markerNum += len(scene.SceneMarkers)
-			stats.Skipped += len(scene.SceneMarkers)
+			imp.record(PlanStep{Phase: "Markers", Action: "skip", SourceID: marker.ID, Label: marker.Title, Reason: "scene not imported"})
+			imp.skipped("Markers", marker.ID, 0, "scene not imported")
+			stats.Skipped++
 			continue
 		}
 
-		for _, marker := range scene.SceneMarkers {
-			markerNum++
-			idx := fmt.Sprintf("[%*d/%d]", digits(totalMarkers), markerNum, totalMarkers)
+		if ghID, ok := imp.idMap.Markers[marker.ID]; ok {
+			imp.record(PlanStep{Phase: "Markers", Action: "skip", SourceID: marker.ID, Label: marker.Title, GHID: ghID, Reason: "already mapped"})
+			fmt.Printf("[Markers] %s Skipped marker %s (already mapped)\n", idx, marker.ID)
+			imp.skipped("Markers", marker.ID, ghID, "already mapped")
+			stats.Skipped++
+			continue
+		}
 
-			if _, ok := imp.idMap.Markers[marker.ID]; ok {
-				fmt.Printf("[Markers] %s Skipped marker %s (already mapped)\n", idx, marker.ID)
-				stats.Skipped++
+		req := GHImportMarkerRequest{
+			SceneID:   ghSceneID,
+			UserID:    imp.cfg.MarkerUserID,
+			Timestamp: int(marker.Seconds),
+			Label:     marker.Title,
+			Color:     "#FFFFFF",
+		}
+
+		if imp.dryRun() {
+			if err := imp.recordCreate("Markers", marker.ID, marker.Title, req, map[string][]string{"scene": {marker.SceneID}}); err != nil {
+				fmt.Printf("[Markers] %s ERROR planning %q: %v\n", idx, marker.Title, err)
+				imp.failed("Markers", marker.ID, err)
+				stats.Errors++
 				continue
 			}
+			if tagIDs := markerTagIDs(marker); len(tagIDs) > 0 {
+				imp.record(PlanStep{Phase: "Markers", Action: "link", SourceID: marker.ID, Label: marker.Title, Reason: "set marker tags",
+					Refs: map[string][]string{"tags": tagIDs}})
+			}
+			fmt.Printf("[Markers] %s [DRY RUN] Would import marker %q at %ds\n", idx, marker.Title, int(marker.Seconds))
+			stats.Created++
+			continue
+		}
 
-			if imp.cfg.DryRun {
-				fmt.Printf("[Markers] %s [DRY RUN] Would import marker %q at %ds\n", idx, marker.Title, int(marker.Seconds))
-				stats.Created++
+		imp.journal.Request(req)
+		created, err := imp.gh.ImportMarker(req)
+		if err != nil {
+			if isConflict(err) {
+				imp.skipped("Markers", marker.ID, 0, "conflict/already exists")
+				stats.Skipped++
 				continue
 			}
+			fmt.Printf("[Markers] %s ERROR importing marker %s: %v\n", idx, marker.ID, err)
+			imp.failed("Markers", marker.ID, err)
+			stats.Errors++
+			continue
+		}
 
-			created, err := imp.gh.ImportMarker(GHImportMarkerRequest{
-				SceneID:   ghSceneID,
-				UserID:    imp.cfg.MarkerUserID,
-				Timestamp: int(marker.Seconds),
-				Label:     marker.Title,
-				Color:     "#FFFFFF",
-			})
-			if err != nil {
-				if isConflict(err) {
-					stats.Skipped++
-					continue
-				}
-				fmt.Printf("[Markers] %s ERROR importing marker %s: %v\n", idx, marker.ID, err)
+		imp.idMap.Markers[marker.ID] = created.ID
+		imp.journal.Created("Markers", marker.ID, created.ID)
+		fmt.Printf("[Markers] %s Created marker %q at %ds (%s -> gh:%d)\n", idx, marker.Title, int(marker.Seconds), imp.sourceRef(marker.ID), created.ID)
+		stats.Created++
+
+		// Collect tags: primary_tag + additional tags
+		tagIDs := imp.mapTagIDs(markerTagIDs(marker))
+		if len(tagIDs) > 0 {
+			if err := imp.gh.SetMarkerTags(created.ID, tagIDs); err != nil {
+				fmt.Printf("[Markers] %s WARNING: failed to set marker tags: %v\n", idx, err)
+			} else {
+				imp.journal.Associated("Markers", marker.ID, created.ID, "tags", nil)
+			}
+		}
+	}
+
+	printStats("Markers", stats)
+	return stats
+}
+
+// --- Phase 6: Saved searches ---
+
+// ImportSavedSearches creates a GoonHub saved search for each of the source's
+// saved scene filters, reporting criteria GoonHub can't express. Searches are
+// matched to existing ones by name.
+func (imp *Importer) ImportSavedSearches(filters []SourceSavedFilter) PhaseStats {
+	stats := PhaseStats{}
+	total := len(filters)
+	fmt.Printf("\n[Searches] Importing %d saved filters...\n", total)
+	if total == 0 {
+		printStats("Searches", stats)
+		return stats
+	}
+
+	existing, err := imp.gh.ListSavedSearches()
+	if err != nil {
+		fmt.Printf("[Searches] ERROR: %v\n", err)
+		stats.Errors = total
+		printStats("Searches", stats)
+		return stats
+	}
+	byName := make(map[string]uint, len(existing))
+	for _, s := range existing {
+		byName[strings.ToLower(s.Name)] = s.ID
+	}
+
+	partial := 0
+	for i, f := range filters {
+		imp.journal.Begin()
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		imp.idMap.Note("Searches", f.ID, f)
+
+		if ghID, ok := imp.idMap.SavedSearches[f.ID]; ok {
+			imp.record(PlanStep{Phase: "Searches", Action: "skip", SourceID: f.ID, Label: f.Name, GHID: ghID, Reason: "already mapped"})
+			fmt.Printf("[Searches] %s Skipped %q (already mapped)\n", idx, f.Name)
+			imp.skipped("Searches", f.ID, ghID, "already mapped")
+			stats.Skipped++
+			continue
+		}
+
+		req, refs, untranslated := translateSavedFilter(f)
+		if len(untranslated) > 0 {
+			fmt.Printf("[Searches] %s %q: can't translate %s\n", idx, f.Name, strings.Join(untranslated, ", "))
+			partial++
+		}
+		if matchesEverything(req.Filters, refs) {
+			imp.record(PlanStep{Phase: "Searches", Action: "skip", SourceID: f.ID, Label: f.Name, Reason: "no translatable criteria"})
+			fmt.Printf("[Searches] %s Skipped %q (no translatable criteria)\n", idx, f.Name)
+			imp.skipped("Searches", f.ID, 0, "no translatable criteria")
+			stats.Skipped++
+			continue
+		}
+
+		if ghID, ok := byName[strings.ToLower(f.Name)]; ok {
+			imp.idMap.SavedSearches[f.ID] = ghID
+			imp.journal.Mapped("Searches", f.ID, ghID)
+			imp.record(PlanStep{Phase: "Searches", Action: "reuse", SourceID: f.ID, Label: f.Name, GHID: ghID, Reason: "existing saved search with the same name"})
+			fmt.Printf("[Searches] %s Reused %q (existing gh:%d)\n", idx, f.Name, ghID)
+			stats.Skipped++
+			continue
+		}
+
+		if imp.dryRun() {
+			if err := imp.recordCreate("Searches", f.ID, f.Name, req, refs); err != nil {
+				fmt.Printf("[Searches] %s ERROR planning %q: %v\n", idx, f.Name, err)
+				imp.failed("Searches", f.ID, err)
 				stats.Errors++
 				continue
 			}
-
-			imp.idMap.Markers[marker.ID] = created.ID
-			fmt.Printf("[Markers] %s Created marker %q at %ds (stash:%s -> gh:%d)\n", idx, marker.Title, int(marker.Seconds), marker.ID, created.ID)
+			fmt.Printf("[Searches] %s [DRY RUN] Would create %q\n", idx, f.Name)
 			stats.Created++
+			continue
+		}
 
-			// Collect tags: primary_tag + additional tags
-			var markerTagIDs []uint
-			if marker.PrimaryTag != nil {
-				if ghTagID, ok := imp.idMap.Tags[marker.PrimaryTag.ID]; ok {
-					markerTagIDs = append(markerTagIDs, ghTagID)
-				}
-			}
-			for _, t := range marker.Tags {
-				if ghTagID, ok := imp.idMap.Tags[t.ID]; ok {
-					markerTagIDs = append(markerTagIDs, ghTagID)
-				}
-			}
+		created, err := imp.createSavedSearch(req, refs)
+		if err != nil {
+			fmt.Printf("[Searches] %s ERROR creating %q: %v\n", idx, f.Name, err)
+			imp.failed("Searches", f.ID, err)
+			stats.Errors++
+			continue
+		}
 
-			if len(markerTagIDs) > 0 {
-				if err := imp.gh.SetMarkerTags(created.ID, markerTagIDs); err != nil {
-					fmt.Printf("[Markers] %s WARNING: failed to set marker tags: %v\n", idx, err)
-				}
+		imp.idMap.SavedSearches[f.ID] = created.ID
+		imp.journal.Created("Searches", f.ID, created.ID)
+		byName[strings.ToLower(f.Name)] = created.ID
+		fmt.Printf("[Searches] %s Created %q (%s -> gh:%d)\n", idx, f.Name, imp.sourceRef(f.ID), created.ID)
+		stats.Created++
+	}
+
+	if partial > 0 {
+		fmt.Printf("[Searches] %d of %d saved filters had criteria that couldn't be translated (see above)\n", partial, total)
+	}
+	printStats("Searches", stats)
+	return stats
+}
+
+// createSavedSearch maps a translated search's source references to GoonHub IDs
+// and creates it. References that weren't imported are dropped with a warning.
+func (imp *Importer) createSavedSearch(req GHCreateSavedSearchRequest, refs map[string][]string) (*GHSavedSearch, error) {
+	var missing []string
+	mapRefs := func(kind string, ids []string, m map[string]uint) []uint {
+		var out []uint
+		for _, id := range ids {
+			if ghID, ok := m[id]; ok {
+				out = append(out, ghID)
+			} else {
+				missing = append(missing, kind+" "+id)
 			}
 		}
+		return out
+	}
+	// Tags go through the tag rules: merged tags become their canonical tag and
+	// dropped ones are left out rather than reported missing.
+	mapTags := func(ids []string) []uint {
+		var kept []string
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			canon, keep := imp.tags.resolve(id)
+			if keep && !seen[canon] {
+				seen[canon] = true
+				kept = append(kept, canon)
+			}
+		}
+		return mapRefs("tag", kept, imp.idMap.Tags)
+	}
+	req.Filters.TagIDs = mapTags(refs["tags"])
+	req.Filters.ExcludeTagIDs = mapTags(refs["exclude_tags"])
+	req.Filters.ActorIDs = mapRefs("performer", refs["actors"], imp.idMap.Actors)
+	req.Filters.StudioIDs = mapRefs("studio", refs["studios"], imp.idMap.Studios)
+	if len(missing) > 0 {
+		fmt.Printf("[Searches] WARNING: %q refers to entities not in GoonHub, dropping them: %s\n", req.Name, strings.Join(missing, ", "))
 	}
 
-	printStats("Markers", stats)
-	return stats
+	imp.journal.Request(req)
+	return imp.gh.CreateSavedSearch(req)
 }
 
 // --- Helpers ---
 
-func (imp *Importer) mapTagIDs(refs []StashIDRef) []uint {
-	var ids []uint
-	for _, ref := range refs {
-		if ghID, ok := imp.idMap.Tags[ref.ID]; ok {
-			ids = append(ids, ghID)
-		}
+// actorRequest builds the create request for a performer.
+func actorRequest(perf SourcePerformer) GHCreateActorRequest {
+	return GHCreateActorRequest{
+		Name:         perf.Name,
+		Gender:       perf.Gender,
+		Ethnicity:    perf.Ethnicity,
+		Nationality:  perf.Nationality,
+		HeightCm:     perf.HeightCm,
+		WeightKg:     perf.WeightKg,
+		Measurements: perf.Measurements,
+		HairColor:    perf.HairColor,
+		EyeColor:     perf.EyeColor,
+		Tattoos:      perf.Tattoos,
+		Piercings:    perf.Piercings,
+		FakeBoobs:    perf.FakeBoobs,
+		Birthday:     perf.Birthday,
+		DateOfDeath:  perf.DateOfDeath,
 	}
-	return ids
 }
 
-func (imp *Importer) mapActorIDs(refs []StashIDRef) []uint {
+// sceneRequest builds the import request for a scene from one of its files. An
+// untitled scene gets the file name as its title. The stored path, storage path,
+// studio and file check are left to the caller.
+func sceneRequest(scene SourceScene, file SourceFile, origin string) GHImportSceneRequest {
+	title := scene.Title
+	if title == "" {
+		title = file.Basename
+	}
+	return GHImportSceneRequest{
+		Title:            title,
+		OriginalFilename: file.Basename,
+		Size:             file.Size,
+		Duration:         int(math.Round(file.Duration)),
+		Width:            file.Width,
+		Height:           file.Height,
+		FrameRate:        file.FrameRate,
+		BitRate:          file.BitRate,
+		VideoCodec:       file.VideoCodec,
+		AudioCodec:       file.AudioCodec,
+		Description:      scene.Details,
+		ReleaseDate:      scene.Date,
+		Origin:           origin,
+	}
+}
+
+// setStudioParent points a studio at its parent, journaling the previous parent so
+// rollback can restore it. Studios already under the right parent are left alone.
+func (imp *Importer) setStudioParent(sourceID string, ghID, parentGHID uint) error {
+	current, err := imp.gh.GetStudio(ghID)
+	if err != nil {
+		return err
+	}
+	if current.ParentID != nil && *current.ParentID == parentGHID {
+		return nil
+	}
+	if err := imp.gh.UpdateStudio(ghID, GHUpdateStudioRequest{ParentID: &parentGHID}); err != nil {
+		return err
+	}
+	imp.journal.Associated("Studios", sourceID, ghID, "parent_id", current.ParentID)
+	return nil
+}
+
+// sourceRef formats a source ID for logs as "<source>:<id>", unless the source
+// already namespaces its IDs that way.
+func (imp *Importer) sourceRef(id string) string {
+	prefix := imp.source.Name() + ":"
+	if strings.HasPrefix(id, prefix) {
+		return id
+	}
+	return prefix + id
+}
+
+// mapTagIDs maps source tag IDs to GoonHub IDs through the tag rules, leaving out
+// dropped tags and duplicates from merged ones.
+func (imp *Importer) mapTagIDs(sourceIDs []string) []uint {
 	var ids []uint
-	for _, ref := range refs {
-		if ghID, ok := imp.idMap.Actors[ref.ID]; ok {
+	seen := make(map[uint]bool)
+	for _, id := range sourceIDs {
+		id, keep := imp.tags.resolve(id)
+		if !keep {
+			continue
+		}
+		if ghID, ok := imp.idMap.Tags[id]; ok && !seen[ghID] {
+			seen[ghID] = true
 			ids = append(ids, ghID)
 		}
 	}
 	return ids
 }
 
-func mapGender(g *string) string {
-	if g == nil {
-		return ""
+// resolveTags applies the tag rules to the source's tags. It needs every tag a
+// run refers to, so that merged tags find their canonical one.
+func (imp *Importer) resolveTags(tags []SourceTag) {
+	if imp.tagRules.Len() == 0 {
+		return
 	}
-	switch strings.ToUpper(*g) {
-	case "MALE":
-		return "male"
-	case "FEMALE":
-		return "female"
-	case "TRANSGENDER_MALE":
-		return "transgender_male"
-	case "TRANSGENDER_FEMALE":
-		return "transgender_female"
-	case "INTERSEX":
-		return "intersex"
-	case "NON_BINARY":
-		return "non_binary"
-	default:
-		return strings.ToLower(*g)
+	imp.tags = imp.tagRules.Resolve(tags, imp.idMap.Tags)
+}
+
+func (imp *Importer) mapActorIDs(sourceIDs []string) []uint {
+	var ids []uint
+	for _, id := range sourceIDs {
+		if ghID, ok := imp.idMap.Actors[id]; ok {
+			ids = append(ids, ghID)
+		}
 	}
+	return ids
 }
 
-func isFakeBoobs(fakeTits *string) bool {
-	if fakeTits == nil {
-		return false
+// markerTagIDs returns the marker's primary tag followed by its other tags.
+func markerTagIDs(marker SourceMarker) []string {
+	var ids []string
+	if marker.PrimaryTagID != "" {
+		ids = append(ids, marker.PrimaryTagID)
 	}
-	v := strings.ToLower(*fakeTits)
-	return v != "" && v != "natural"
+	return append(ids, marker.TagIDs...)
 }
 
 func derefStr(s *string) string {
@@ -545,8 +919,8 @@ func derefStr(s *string) string {
 }
 
 func isConflict(err error) bool {
-	_, ok := err.(*ConflictError)
-	return ok
+	var conflictErr *ConflictError
+	return errors.As(err, &conflictErr)
 }
 
 func digits(n int) int {
@@ -562,6 +936,13 @@ func digits(n int) int {
 }
 
 func printStats(phase string, stats PhaseStats) {
-	fmt.Printf("[%s] Done: %d created, %d skipped, %d errors\n",
-		phase, stats.Created, stats.Skipped, stats.Errors)
+	parts := []string{fmt.Sprintf("%d created", stats.Created)}
+	if stats.Updated > 0 {
+		parts = append(parts, fmt.Sprintf("%d updated", stats.Updated))
+	}
+	if stats.Deleted > 0 {
+		parts = append(parts, fmt.Sprintf("%d deleted", stats.Deleted))
+	}
+	parts = append(parts, fmt.Sprintf("%d skipped", stats.Skipped), fmt.Sprintf("%d errors", stats.Errors))
+	fmt.Printf("[%s] Done: %s\n", phase, strings.Join(parts, ", "))
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunJournal is an append-only JSON-lines record of one run, written as it happens
+// so it survives a crash: what it created, mapped and changed in GoonHub (read back
+// by rollback) plus every skip and failure (read by history).
+// A nil *RunJournal records nothing, so dry runs can pass one around freely.
+type RunJournal struct {
+	ID   string
+	Path string
+	file *os.File
+
+	// Per-entity context set by Begin/Request and added to every entry.
+	begun       time.Time
+	requestHash string
+}
+
+// JournalEntry is one line of a run journal.
+//
+// Actions:
+//   - started:     first line; Command and Source describe the run, DryRun marks
+//     a run that wrote nothing to GoonHub
+//   - created:     GHID was created for SourceID
+//   - mapped:      SourceID was mapped to the existing GHID
+//   - associated:  Field of GHID was changed; Previous (an ID) or PreviousIDs (a
+//     list of IDs, such as scene tags) holds the old value when the entity
+//     existed before the run
+//   - skipped:     SourceID was left alone, see Reason
+//   - failed:      SourceID could not be imported, see Error
+//   - finished:    last line of a completed run; Stats has the phase totals
+//   - rolled_back: the run was rolled back
+//
+// RequestHash is the SHA-256 of the JSON request body sent for the entity, and
+// DurationMs the time spent on it so far.
+type JournalEntry struct {
+	Time        time.Time             `json:"time"`
+	Phase       string                `json:"phase,omitempty"`
+	Action      string                `json:"action"`
+	SourceID    string                `json:"source_id,omitempty"`
+	GHID        uint                  `json:"gh_id,omitempty"`
+	Field       string                `json:"field,omitempty"`
+	Previous    *uint                 `json:"previous,omitempty"`
+	PreviousIDs *[]uint               `json:"previous_ids,omitempty"`
+	Reason      string                `json:"reason,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	RequestHash string                `json:"request_hash,omitempty"`
+	DurationMs  int64                 `json:"duration_ms,omitempty"`
+	Command     string                `json:"command,omitempty"`
+	Source      string                `json:"source,omitempty"`
+	DryRun      bool                  `json:"dry_run,omitempty"`
+	Stats       map[string]PhaseStats `json:"stats,omitempty"`
+}
+
+// NewRunJournal creates a journal file named after the current time in dir.
+func NewRunJournal(dir string) (*RunJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	base := time.Now().Format("20060102-150405")
+	for n := 1; ; n++ {
+		id := base
+		if n > 1 {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		path := journalPath(dir, id)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create journal: %w", err)
+		}
+		return &RunJournal{ID: id, Path: path, file: f}, nil
+	}
+}
+
+// OpenRunJournal opens an existing journal for appending.
+func OpenRunJournal(dir, id string) (*RunJournal, error) {
+	path := journalPath(dir, id)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal for run %s: %w", id, err)
+	}
+	return &RunJournal{ID: id, Path: path, file: f}, nil
+}
+
+// ReadJournal returns every entry of a run's journal in order.
+func ReadJournal(dir, id string) ([]JournalEntry, error) {
+	f, err := os.Open(journalPath(dir, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal for run %s: %w", id, err)
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse journal line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
+
+func journalPath(dir, id string) string {
+	return filepath.Join(dir, id+".jsonl")
+}
+
+// ListRuns returns the IDs of all journaled runs, oldest first.
+func ListRuns(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(m), ".jsonl"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (j *RunJournal) Started(command, source string, dryRun bool) {
+	j.write(JournalEntry{Action: "started", Command: command, Source: source, DryRun: dryRun})
+}
+
+func (j *RunJournal) Finished(stats map[string]PhaseStats) {
+	j.write(JournalEntry{Action: "finished", Stats: stats})
+}
+
+// Begin starts timing the next entity and clears the previous one's request hash.
+func (j *RunJournal) Begin() {
+	if j == nil {
+		return
+	}
+	j.begun = time.Now()
+	j.requestHash = ""
+}
+
+// Request records the hash of the request body about to be sent for the current entity.
+func (j *RunJournal) Request(req any) {
+	if j == nil {
+		return
+	}
+	j.requestHash, _ = hashJSON(req)
+}
+
+func (j *RunJournal) Skipped(phase, sourceID string, ghID uint, reason string) {
+	j.write(JournalEntry{Phase: phase, Action: "skipped", SourceID: sourceID, GHID: ghID, Reason: reason})
+}
+
+func (j *RunJournal) Failed(phase, sourceID string, err error) {
+	j.write(JournalEntry{Phase: phase, Action: "failed", SourceID: sourceID, Error: err.Error()})
+}
+
+func (j *RunJournal) Created(phase, sourceID string, ghID uint) {
+	j.write(JournalEntry{Phase: phase, Action: "created", SourceID: sourceID, GHID: ghID})
+}
+
+func (j *RunJournal) Mapped(phase, sourceID string, ghID uint) {
+	j.write(JournalEntry{Phase: phase, Action: "mapped", SourceID: sourceID, GHID: ghID})
+}
+
+func (j *RunJournal) Associated(phase, sourceID string, ghID uint, field string, previous *uint) {
+	j.write(JournalEntry{Phase: phase, Action: "associated", SourceID: sourceID, GHID: ghID, Field: field, Previous: previous})
+}
+
+func (j *RunJournal) RolledBack() {
+	j.write(JournalEntry{Action: "rolled_back"})
+}
+
+func (j *RunJournal) write(e JournalEntry) {
+	if j == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	if e.Phase != "" {
+		e.RequestHash = j.requestHash
+		if !j.begun.IsZero() {
+			e.DurationMs = time.Since(j.begun).Milliseconds()
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to write run journal: %v\n", err)
+	}
+}
+
+func (j *RunJournal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
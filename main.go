@@ -1,27 +1,151 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 )
 
+const usage = `Usage: goonhub-stash-importer [command] [flags]
+
+Commands:
+  import          Import the configured source into GoonHub (default)
+  reverse         Write GoonHub edits back to Stash (dry-run diff unless --apply)
+  plan            Write a reviewable import plan file (nothing is written to GoonHub)
+  apply           Execute a plan file, refusing if Stash/GoonHub changed since it was made
+  retry-failed    Re-attempt only the entities that failed in earlier runs
+  history         List past runs (dry runs included), or show one run's journal entries
+  rollback        Undo a run recorded in runs/ (list only unless --apply)
+  prune           Delete GoonHub entities whose source counterpart was deleted (list only unless --apply)
+  sync            Sync edits in both directions with conflict detection (plan only unless --apply)
+  relocate        Update GoonHub paths of imported scenes after mappings changed (list only unless --apply)
+  check-mappings  Show which path mapping covers each source directory and suggest missing ones
+  migrate-id-map  Copy id_map.json into the SQLite ID map store (id_map.db)
+  storage-paths   Check mappings against GoonHub's storage paths (--save writes inferred storage_path_ids)
+`
+
 func main() {
+	command := "import"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var run func(cfg *Config, args []string)
+	load := LoadConfig
+	switch command {
+	case "import":
+		run = runImport
+	case "reverse":
+		run = runReverse
+	case "plan":
+		run = runPlan
+	case "apply":
+		run = runApply
+	case "retry-failed":
+		run = runRetryFailed
+	case "history":
+		run = runHistory
+	case "rollback":
+		run = runRollback
+	case "prune":
+		run = runPrune
+	case "sync":
+		run = runSync
+	case "relocate":
+		run = runRelocate
+	case "check-mappings":
+		// Only reads the source and the mappings, so GoonHub needn't be configured.
+		run, load = runCheckMappings, LoadSourceConfig
+	case "migrate-id-map":
+		run = runMigrateIDMap
+	case "storage-paths":
+		run = runStoragePaths
+	case "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
 	fmt.Println("=== Stash -> GoonHub Importer ===")
 	fmt.Println()
 
 	// 1. Load config
-	cfg, err := LoadConfig()
+	cfg, err := load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
 		os.Exit(1)
 	}
+	run(cfg, args)
+	releaseIDMap()
+}
+
+func runImport(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	scope := addScopeFlags(fs)
+	_ = fs.Parse(args)
+
+	imp, data := mustPrepareImport(cfg, scope)
+	imp.journal = mustStartJournal(cfg, "import", imp.source.Name())
+	imp.idMap.RunID = imp.journal.ID
+	defer imp.journal.Close()
+	if !cfg.DryRun {
+		imp.failures = mustLoadFailures(cfg)
+	}
+
+	// 9. Run import phases
+	allStats := imp.RunPhases(data)
+	imp.journal.Finished(allStats)
+
+	// 10. Print summary
+	printSummary("Import", allStats)
+	if !cfg.DryRun {
+		printReindexHint(cfg, allStats)
+	}
+
+	printJournalHint(imp.journal, cfg.DryRun)
+
+	if totalErrors(allStats) > 0 {
+		if !cfg.DryRun {
+			fmt.Printf("\nFailed entities were recorded in %s (re-attempt them with: retry-failed)\n", cfg.FailuresFile)
+		}
+		imp.journal.Close()
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// mustPrepareImport runs the setup shared by import, plan and apply: path mappings,
+// ID map, source, GoonHub login, pre-fetch and source fetch narrowed to scope.
+// Exits on error.
+func mustPrepareImport(cfg *Config, scope *ImportScope) (*Importer, *SourceData) {
+	imp := mustSetupImporter(cfg)
+	imp.scope = scope
+
+	// 8. Fetch all data from the source
+	data, err := FetchSourceData(imp.source, scope, imp.parser, cfg.SceneLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+	imp.resolveTags(data.Tags)
+	return imp, data
+}
+
+// mustSetupImporter is mustPrepareImport without the source fetch.
+func mustSetupImporter(cfg *Config) *Importer {
 	if cfg.DryRun {
 		fmt.Println("[Config]  DRY RUN mode enabled - no changes will be made")
 	}
 	if cfg.SceneLimit > 0 {
 		fmt.Printf("[Config]  Scene limit: %d\n", cfg.SceneLimit)
 	}
-	fmt.Printf("[Config]  Stash:   %s\n", cfg.StashBaseURL)
+	if cfg.VerifyFiles != "" {
+		fmt.Printf("[Config]  Verifying scene files (%s) under %s\n", cfg.VerifyFiles, cfg.VerifyRoot)
+	}
 	fmt.Printf("[Config]  GoonHub: %s\n", cfg.GoonHubBaseURL)
 
 	// 2. Load path mappings
@@ -33,12 +157,10 @@ func main() {
 	fmt.Printf("[Config]  Loaded %d path mapping(s)\n", len(mappings))
 	cfg.PathMappings = mappings
 
+	rules := mustLoadImportRules(cfg)
+
 	// 3. Load ID map (for resume)
-	idMap, err := LoadIDMap(cfg.IDMapFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
-		os.Exit(1)
-	}
+	idMap := mustLoadIDMap(cfg)
 	existing := len(idMap.Tags) + len(idMap.Studios) + len(idMap.Actors) + len(idMap.Scenes) + len(idMap.Markers)
 	if existing > 0 {
 		fmt.Printf("[Config]  Resuming with %d existing mappings (tags:%d studios:%d actors:%d scenes:%d markers:%d)\n",
@@ -46,138 +168,206 @@ func main() {
 	}
 
 	// 4. Initialize clients
-	stashClient := NewStashClient(cfg.StashBaseURL, cfg.StashAPIKey)
-	ghClient := NewGoonHubClient(cfg.GoonHubBaseURL)
-	pathMapper := NewPathMapper(cfg.PathMappings)
+	source, err := OpenSource(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// 5. Authenticate with GoonHub
-	fmt.Printf("\n[Auth]    Logging in to GoonHub as %q...\n", cfg.GoonHubUsername)
-	if err := ghClient.Login(cfg.GoonHubUsername, cfg.GoonHubPassword); err != nil {
-		fmt.Fprintf(os.Stderr, "GoonHub login failed: %v\n", err)
+	ghClient := mustLoginGoonHub(cfg)
+
+	// 6. Check path mappings against GoonHub's storage paths
+	mustCheckStoragePaths(cfg, ghClient)
+	pathMapper, err := NewPathMapper(cfg.PathMappings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println("[Auth]    Login successful")
 
-	// 6. Initialize importer
-	imp := NewImporter(stashClient, ghClient, idMap, pathMapper, cfg)
+	// 7. Initialize importer
+	imp := NewImporter(source, ghClient, idMap, pathMapper, cfg)
+	imp.tagRules = rules.tagRules
+	imp.transforms = rules.transforms
+	imp.parser = rules.parser
 
-	// 7. Pre-fetch existing GH entities
+	// 8. Pre-fetch existing GH entities
 	if err := imp.PreFetchExisting(); err != nil {
 		fmt.Fprintf(os.Stderr, "Pre-fetch error: %v\n", err)
 		os.Exit(1)
 	}
+	return imp
+}
 
-	// 8. Fetch all data from Stash
-	fmt.Println("\n[Stash]   Fetching data from Stash...")
+// importRules are the optional files that shape what the importer sends: tag
+// rules, field transforms and filename patterns.
+type importRules struct {
+	tagRules   *TagRules
+	transforms *Transforms
+	parser     *FilenameParser
+}
 
-	stashTags, err := stashClient.FetchTags()
+// mustLoadImportRules loads the tag rules, transforms and filename patterns,
+// exiting on error.
+func mustLoadImportRules(cfg *Config) importRules {
+	tagRules, err := LoadTagRules(cfg.TagRulesFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to fetch Stash tags: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Tag rules error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[Stash]   Found %d tags\n", len(stashTags))
-
-	stashStudios, err := stashClient.FetchStudios()
+	if tagRules.Len() > 0 {
+		fmt.Printf("[Config]  Loaded %d tag rule(s) from %s\n", tagRules.Len(), cfg.TagRulesFile)
+	}
+	transforms, err := LoadTransforms(cfg.TransformsFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to fetch Stash studios: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Transforms error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[Stash]   Found %d studios\n", len(stashStudios))
-
-	stashPerformers, err := stashClient.FetchPerformers()
+	if transforms.Len() > 0 {
+		fmt.Printf("[Config]  Loaded %d field transform(s) from %s\n", transforms.Len(), cfg.TransformsFile)
+	}
+	parser, err := LoadFilenameParser(cfg.PatternsFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to fetch Stash performers: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Filename patterns error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[Stash]   Found %d performers\n", len(stashPerformers))
+	if parser.Len() > 0 {
+		fmt.Printf("[Config]  Loaded %d filename pattern(s) from %s\n", parser.Len(), cfg.PatternsFile)
+	}
+	return importRules{tagRules: tagRules, transforms: transforms, parser: parser}
+}
 
-	stashScenes, err := stashClient.FetchScenes()
+// mustStartJournal creates the journal for a run, exiting on error. Dry runs are
+// journaled too, marked as such.
+func mustStartJournal(cfg *Config, command, source string) *RunJournal {
+	journal, err := NewRunJournal(cfg.RunsDir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to fetch Stash scenes: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Journal error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("[Stash]   Found %d scenes\n", len(stashScenes))
-
-	if cfg.SceneLimit > 0 && len(stashScenes) > cfg.SceneLimit {
-		fmt.Printf("[Stash]   Limiting to %d scenes (SCENE_LIMIT)\n", cfg.SceneLimit)
-		stashScenes = stashScenes[:cfg.SceneLimit]
-	}
+	journal.Started(command, source, cfg.DryRun)
+	fmt.Printf("[Journal] Run %s\n", journal.ID)
+	return journal
+}
 
-	// Count total markers
-	totalMarkers := 0
-	for _, s := range stashScenes {
-		totalMarkers += len(s.SceneMarkers)
+// printJournalHint tells where the run was journaled and how to undo it.
+func printJournalHint(journal *RunJournal, dryRun bool) {
+	if dryRun {
+		fmt.Printf("\nDry run %s journaled to %s\n", journal.ID, journal.Path)
+		return
 	}
-	fmt.Printf("[Stash]   Found %d scene markers\n", totalMarkers)
-
-	// 9. Run import phases
-	allStats := make(map[string]PhaseStats)
+	fmt.Printf("\nRun %s journaled to %s (undo with: rollback %s)\n", journal.ID, journal.Path, journal.ID)
+}
 
-	// Phase 1: Tags
-	tagStats := imp.ImportTags(stashTags)
-	allStats["Tags"] = tagStats
-	if !cfg.DryRun {
-		if err := idMap.Save(cfg.IDMapFile); err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after tags: %v\n", err)
+func printSummary(title string, allStats map[string]PhaseStats) {
+	fmt.Printf("\n=== %s Summary ===\n", title)
+	var total PhaseStats
+	for _, phase := range []string{"Tags", "Studios", "Actors", "Scenes", "Markers", "Searches"} {
+		s, ok := allStats[phase]
+		if !ok && phase == "Searches" {
+			continue
 		}
+		fmt.Printf("  %-10s %d created, %d skipped, %d errors\n", phase+":", s.Created, s.Skipped, s.Errors)
+		total.Created += s.Created
+		total.Skipped += s.Skipped
+		total.Errors += s.Errors
 	}
+	fmt.Printf("  %-10s %d created, %d skipped, %d errors\n", "Total:", total.Created, total.Skipped, total.Errors)
+}
 
-	// Phase 2: Studios
-	studioStats := imp.ImportStudios(stashStudios)
-	allStats["Studios"] = studioStats
-	if !cfg.DryRun {
-		if err := idMap.Save(cfg.IDMapFile); err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after studios: %v\n", err)
+func printReindexHint(cfg *Config, allStats map[string]PhaseStats) {
+	for _, s := range allStats {
+		if s.Created > 0 {
+			fmt.Printf("\nRemember to rebuild the search index:\n")
+			fmt.Printf("  curl -X POST %s/api/v1/admin/search/reindex -H \"Authorization: Bearer <token>\"\n", cfg.GoonHubBaseURL)
+			return
 		}
 	}
+}
 
-	// Phase 3: Performers -> Actors
-	actorStats := imp.ImportPerformers(stashPerformers)
-	allStats["Actors"] = actorStats
-	if !cfg.DryRun {
-		if err := idMap.Save(cfg.IDMapFile); err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after actors: %v\n", err)
-		}
+func totalErrors(allStats map[string]PhaseStats) int {
+	n := 0
+	for _, s := range allStats {
+		n += s.Errors
 	}
+	return n
+}
 
-	// Phase 4: Scenes
-	sceneStats := imp.ImportScenes(stashScenes)
-	allStats["Scenes"] = sceneStats
-	if !cfg.DryRun {
-		if err := idMap.Save(cfg.IDMapFile); err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after scenes: %v\n", err)
+// --- Shared command setup ---
+
+// idMapLock and idMapStore are held from mustLoadIDMap until the command
+// returns. Commands that exit early call releaseIDMap first; any that don't leave
+// the lock file behind, and the next run sees its process is gone and takes it
+// over.
+var (
+	idMapLock  *IDMapLock
+	idMapStore IDMapStore
+)
+
+// releaseIDMap closes the ID map store and releases its lock.
+func releaseIDMap() {
+	if idMapStore != nil {
+		if err := idMapStore.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
 		}
+		idMapStore = nil
 	}
+	idMapLock.Release()
+	idMapLock = nil
+}
 
-	// Phase 5: Markers
-	markerStats := imp.ImportMarkers(stashScenes)
-	allStats["Markers"] = markerStats
-	if !cfg.DryRun {
-		if err := idMap.Save(cfg.IDMapFile); err != nil {
-			fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after markers: %v\n", err)
+// mustLoadIDMap locks and loads the ID map from the configured store, exiting on
+// error.
+func mustLoadIDMap(cfg *Config) *IDMap {
+	if idMapLock == nil {
+		lock, err := LockIDMap(idMapPath(cfg))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+			os.Exit(1)
 		}
+		idMapLock = lock
+	}
+	store, err := OpenIDMapStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+		os.Exit(1)
+	}
+	idMapStore = store
+	idMap, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// 10. Print summary
-	fmt.Println("\n=== Import Summary ===")
-	totalCreated := 0
-	totalSkipped := 0
-	totalErrors := 0
-	for _, phase := range []string{"Tags", "Studios", "Actors", "Scenes", "Markers"} {
-		s := allStats[phase]
-		fmt.Printf("  %-10s %d created, %d skipped, %d errors\n", phase+":", s.Created, s.Skipped, s.Errors)
-		totalCreated += s.Created
-		totalSkipped += s.Skipped
-		totalErrors += s.Errors
+	// An empty database next to an existing id_map.json means it wasn't migrated;
+	// importing with an empty map would duplicate everything.
+	if cfg.IDMapStore == "sqlite" && idMap.Len() == 0 {
+		if _, err := os.Stat(cfg.IDMapFile); err == nil {
+			fmt.Fprintf(os.Stderr, "ID map error: %s is empty but %s exists; run migrate-id-map first\n", cfg.IDMapDBFile, cfg.IDMapFile)
+			os.Exit(1)
+		}
 	}
-	fmt.Printf("  %-10s %d created, %d skipped, %d errors\n", "Total:", totalCreated, totalSkipped, totalErrors)
+	return idMap
+}
 
-	if !cfg.DryRun && totalCreated > 0 {
-		fmt.Printf("\nRemember to rebuild the search index:\n")
-		fmt.Printf("  curl -X POST %s/api/v1/admin/search/reindex -H \"Authorization: Bearer <token>\"\n", cfg.GoonHubBaseURL)
+// mustLoadFailures loads the failure list, exiting on error.
+func mustLoadFailures(cfg *Config) *FailureList {
+	failures, err := LoadFailureList(cfg.FailuresFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failure list error: %v\n", err)
+		os.Exit(1)
 	}
+	return failures
+}
 
-	if totalErrors > 0 {
+// mustLoginGoonHub creates a GoonHub client and logs in, exiting on error.
+func mustLoginGoonHub(cfg *Config) *GoonHubClient {
+	ghClient := NewGoonHubClient(cfg.GoonHubBaseURL)
+	fmt.Printf("\n[Auth]    Logging in to GoonHub as %q...\n", cfg.GoonHubUsername)
+	if err := ghClient.Login(cfg.GoonHubUsername, cfg.GoonHubPassword); err != nil {
+		fmt.Fprintf(os.Stderr, "GoonHub login failed: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Println("[Auth]    Login successful")
+	return ghClient
 }
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxManifestErrors caps how many row errors are listed before giving up on the list.
+const maxManifestErrors = 50
+
+// ManifestSource reads scenes from a CSV or JSON-lines manifest (see README for the
+// format). Scene IDs are the row's "id" column, or its path when absent; tags,
+// studios and performers are identified by lowercased name. All IDs are prefixed
+// with "manifest:".
+type ManifestSource struct {
+	file       string
+	tags       []SourceTag
+	studios    []SourceStudio
+	performers []SourcePerformer
+	scenes     []SourceScene
+	markers    []SourceMarker
+}
+
+type manifestRow struct {
+	line       int
+	ID         string           `json:"id"`
+	Path       string           `json:"path"`
+	Title      string           `json:"title"`
+	Details    string           `json:"details"`
+	Date       string           `json:"date"`
+	Studio     string           `json:"studio"`
+	Performers []string         `json:"performers"`
+	Tags       []string         `json:"tags"`
+	Markers    []manifestMarker `json:"markers"`
+	Size       int64            `json:"size"`
+	Duration   float64          `json:"duration"`
+}
+
+type manifestMarker struct {
+	Seconds float64  `json:"seconds"`
+	Title   string   `json:"title"`
+	Tags    []string `json:"tags"`
+}
+
+// ManifestRowError is a problem with one manifest line.
+type ManifestRowError struct {
+	Line    int
+	Message string
+}
+
+// ManifestErrors lists every invalid row so a manifest can be fixed in one go.
+type ManifestErrors struct {
+	File string
+	Rows []ManifestRowError
+}
+
+func (e *ManifestErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s has %d invalid row(s):", e.File, len(e.Rows))
+	for i, r := range e.Rows {
+		if i == maxManifestErrors {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(e.Rows)-maxManifestErrors)
+			break
+		}
+		fmt.Fprintf(&b, "\n  line %d: %s", r.Line, r.Message)
+	}
+	return b.String()
+}
+
+func rowError(line int, format string, args ...any) ManifestRowError {
+	return ManifestRowError{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+func NewManifestSource(file string) (*ManifestSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var rows []manifestRow
+	var rowErrs []ManifestRowError
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		rows, rowErrs, err = readManifestCSV(f)
+	case ".jsonl", ".ndjson":
+		rows, rowErrs, err = readManifestJSONL(f)
+	default:
+		return nil, fmt.Errorf("unsupported manifest extension %q (expected .csv, .jsonl or .ndjson)", filepath.Ext(file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	s := &ManifestSource{file: file}
+	rowErrs = append(rowErrs, s.build(rows)...)
+	if len(rowErrs) > 0 {
+		sort.SliceStable(rowErrs, func(i, j int) bool { return rowErrs[i].Line < rowErrs[j].Line })
+		return nil, &ManifestErrors{File: file, Rows: rowErrs}
+	}
+	return s, nil
+}
+
+func (s *ManifestSource) Name() string {
+	return "manifest"
+}
+
+func (s *ManifestSource) Tags() ([]SourceTag, error)             { return s.tags, nil }
+func (s *ManifestSource) Studios() ([]SourceStudio, error)       { return s.studios, nil }
+func (s *ManifestSource) Performers() ([]SourcePerformer, error) { return s.performers, nil }
+func (s *ManifestSource) Scenes() ([]SourceScene, error)         { return s.scenes, nil }
+func (s *ManifestSource) Markers() ([]SourceMarker, error)       { return s.markers, nil }
+
+// build validates rows and turns them into entities, returning one error per problem.
+func (s *ManifestSource) build(rows []manifestRow) []ManifestRowError {
+	var errs []ManifestRowError
+	sceneLines := make(map[string]int)
+	tagSeen := make(map[string]bool)
+	studioSeen := make(map[string]bool)
+	actorSeen := make(map[string]bool)
+
+	addTag := func(name string) string {
+		id := nameID("manifest", name)
+		if !tagSeen[id] {
+			tagSeen[id] = true
+			s.tags = append(s.tags, SourceTag{ID: id, Name: strings.TrimSpace(name)})
+		}
+		return id
+	}
+
+	for _, row := range rows {
+		rowErr := func(format string, args ...any) {
+			errs = append(errs, rowError(row.line, format, args...))
+		}
+
+		row.Path = strings.TrimSpace(row.Path)
+		if row.Path == "" {
+			rowErr("path is required")
+			continue
+		}
+		id := strings.TrimSpace(row.ID)
+		if id == "" {
+			id = row.Path
+		}
+		id = "manifest:" + id
+		if first, ok := sceneLines[id]; ok {
+			rowErr("duplicate scene %q (first seen on line %d)", strings.TrimPrefix(id, "manifest:"), first)
+			continue
+		}
+		sceneLines[id] = row.line
+
+		var date *string
+		if d := strings.TrimSpace(row.Date); d != "" {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				rowErr("invalid date %q (expected YYYY-MM-DD)", d)
+				continue
+			}
+			date = &d
+		}
+		if row.Size < 0 || row.Duration < 0 {
+			rowErr("size and duration must not be negative")
+			continue
+		}
+
+		scene := SourceScene{
+			ID:      id,
+			Title:   strings.TrimSpace(row.Title),
+			Details: strings.TrimSpace(row.Details),
+			Date:    date,
+			Files: []SourceFile{{
+				Path:     row.Path,
+				Basename: manifestBasename(row.Path),
+				Size:     row.Size,
+				Duration: row.Duration,
+			}},
+		}
+
+		if name := strings.TrimSpace(row.Studio); name != "" {
+			scene.StudioID = nameID("manifest", name)
+			if !studioSeen[scene.StudioID] {
+				studioSeen[scene.StudioID] = true
+				s.studios = append(s.studios, SourceStudio{ID: scene.StudioID, Name: name})
+			}
+		}
+		for _, name := range row.Performers {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+			actorID := nameID("manifest", name)
+			if !actorSeen[actorID] {
+				actorSeen[actorID] = true
+				s.performers = append(s.performers, SourcePerformer{ID: actorID, Name: strings.TrimSpace(name)})
+			}
+			scene.PerformerIDs = append(scene.PerformerIDs, actorID)
+		}
+		for _, name := range row.Tags {
+			if strings.TrimSpace(name) != "" {
+				scene.TagIDs = append(scene.TagIDs, addTag(name))
+			}
+		}
+
+		markerIDs := make(map[string]bool)
+		for _, m := range row.Markers {
+			if m.Seconds < 0 {
+				rowErr("marker %q has a negative timestamp", m.Title)
+				continue
+			}
+			markerID := fmt.Sprintf("%s#%s", id, strconv.FormatFloat(m.Seconds, 'f', -1, 64))
+			if markerIDs[markerID] {
+				rowErr("more than one marker at %gs", m.Seconds)
+				continue
+			}
+			markerIDs[markerID] = true
+
+			marker := SourceMarker{
+				ID:      markerID,
+				SceneID: id,
+				Title:   strings.TrimSpace(m.Title),
+				Seconds: m.Seconds,
+			}
+			// The first tag is the marker's primary tag.
+			for _, name := range m.Tags {
+				if strings.TrimSpace(name) == "" {
+					continue
+				}
+				if marker.PrimaryTagID == "" {
+					marker.PrimaryTagID = addTag(name)
+				} else {
+					marker.TagIDs = append(marker.TagIDs, addTag(name))
+				}
+			}
+			s.markers = append(s.markers, marker)
+		}
+
+		s.scenes = append(s.scenes, scene)
+	}
+	return errs
+}
+
+// --- CSV ---
+
+// readManifestCSV reads a CSV manifest with a header row. List columns (performers,
+// tags, markers) separate entries with "|"; a marker entry is "time;title;tag1,tag2".
+func readManifestCSV(r io.Reader) ([]manifestRow, []ManifestRowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("manifest is empty")
+		}
+		return nil, nil, err
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if _, ok := cols["path"]; !ok {
+		return nil, nil, fmt.Errorf("CSV header must include a path column")
+	}
+
+	var rows []manifestRow
+	var errs []ManifestRowError
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, rowError(parseErr.Line, "%v", parseErr.Err))
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := manifestRow{
+			line:       line,
+			ID:         get("id"),
+			Path:       get("path"),
+			Title:      get("title"),
+			Details:    get("details"),
+			Date:       get("date"),
+			Studio:     get("studio"),
+			Performers: splitList(get("performers"), "|"),
+			Tags:       splitList(get("tags"), "|"),
+		}
+		if v := get("size"); v != "" {
+			if row.Size, err = strconv.ParseInt(v, 10, 64); err != nil {
+				errs = append(errs, rowError(line, "invalid size %q", v))
+				continue
+			}
+		}
+		if v := get("duration"); v != "" {
+			if row.Duration, err = parseTimestamp(v); err != nil {
+				errs = append(errs, rowError(line, "invalid duration %q", v))
+				continue
+			}
+		}
+		markersOK := true
+		for _, entry := range splitList(get("markers"), "|") {
+			parts := strings.SplitN(entry, ";", 3)
+			seconds, err := parseTimestamp(parts[0])
+			if err != nil {
+				errs = append(errs, rowError(line, "invalid marker time %q", parts[0]))
+				markersOK = false
+				break
+			}
+			m := manifestMarker{Seconds: seconds}
+			if len(parts) > 1 {
+				m.Title = strings.TrimSpace(parts[1])
+			}
+			if len(parts) > 2 {
+				m.Tags = splitList(parts[2], ",")
+			}
+			row.Markers = append(row.Markers, m)
+		}
+		if !markersOK {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs, nil
+}
+
+// --- JSON lines ---
+
+func readManifestJSONL(r io.Reader) ([]manifestRow, []ManifestRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var rows []manifestRow
+	var errs []ManifestRowError
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		var row manifestRow
+		if err := dec.Decode(&row); err != nil {
+			errs = append(errs, rowError(line, "%v", err))
+			continue
+		}
+		row.line = line
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, errs, nil
+}
+
+// --- Helpers ---
+
+// parseTimestamp accepts plain seconds ("754.5") or clock time ("12:34", "1:02:03").
+func parseTimestamp(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ":") {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return v, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	total := 0.0
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		total = total*60 + v
+	}
+	return total, nil
+}
+
+func splitList(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// manifestBasename handles both forward- and backslash-separated paths.
+func manifestBasename(p string) string {
+	return path.Base(strings.ReplaceAll(p, `\`, "/"))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runMigrateIDMap copies a JSON ID map into the SQLite store.
+func runMigrateIDMap(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("migrate-id-map", flag.ExitOnError)
+	from := fs.String("from", cfg.IDMapFile, "JSON id map to read")
+	to := fs.String("to", cfg.IDMapDBFile, "SQLite database to write")
+	force := fs.Bool("force", false, "merge into a database that already has mappings")
+	_ = fs.Parse(args)
+
+	if _, err := os.Stat(*from); err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate failed: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range []string{*from, *to} {
+		lock, err := LockIDMap(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+			os.Exit(1)
+		}
+		defer lock.Release()
+	}
+
+	src, err := (&JSONIDMapStore{Path: *from}).Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+		os.Exit(1)
+	}
+	dst, err := OpenSQLiteIDMapStore(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+		os.Exit(1)
+	}
+	defer dst.Close()
+	merged, err := dst.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ID map error: %v\n", err)
+		os.Exit(1)
+	}
+	if merged.Len() > 0 && !*force {
+		fmt.Fprintf(os.Stderr, "Migrate failed: %s already has %d mappings (use --force to merge %s into it)\n", *to, merged.Len(), *from)
+		os.Exit(1)
+	}
+
+	fmt.Printf("[Migrate] Copying %d mappings from %s to %s...\n", src.Len(), *from, *to)
+	var counts []string
+	targets := merged.kinds()
+	for i, k := range src.kinds() {
+		for sourceID, ghID := range k.IDs {
+			targets[i].IDs[sourceID] = ghID
+		}
+		counts = append(counts, fmt.Sprintf("%s:%d", k.Name, len(k.IDs)))
+	}
+	if err := merged.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Read the count back so a short write can't go unnoticed.
+	n, err := dst.Count()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate failed: %v\n", err)
+		os.Exit(1)
+	}
+	if n != merged.Len() {
+		fmt.Fprintf(os.Stderr, "Migrate failed: %s has %d mappings, expected %d\n", *to, n, merged.Len())
+		os.Exit(1)
+	}
+	fmt.Printf("[Migrate] Done: %d mappings in %s (%s)\n", n, *to, strings.Join(counts, " "))
+	fmt.Printf("\nSet IDMAP_STORE=sqlite to use it. %s is left as it was and is no longer updated.\n", *from)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mkv": true, ".avi": true, ".wmv": true, ".mov": true,
+	".webm": true, ".flv": true, ".mpg": true, ".mpeg": true, ".ts": true, ".m2ts": true,
+}
+
+// NFOSource reads a directory tree of video files with Kodi/Jellyfin .nfo sidecars.
+// A video's sidecar is "<basename>.nfo" next to it, or "movie.nfo" when the video is
+// the only one in its folder. Videos without a sidecar are skipped.
+//
+// NFO files carry no IDs, so IDs are derived: scenes use the video path, tags,
+// studios and actors use their lowercased name. All IDs are prefixed with "nfo:"
+// so they can't collide with Stash IDs in the same id_map.json.
+type NFOSource struct {
+	root       string
+	tags       []SourceTag
+	studios    []SourceStudio
+	performers []SourcePerformer
+	scenes     []SourceScene
+}
+
+// nfoDoc covers the fields of <movie> and <episodedetails> documents we use.
+type nfoDoc struct {
+	XMLName    xml.Name
+	Title      string      `xml:"title"`
+	Plot       string      `xml:"plot"`
+	Outline    string      `xml:"outline"`
+	Studios    []string    `xml:"studio"`
+	ShowTitle  string      `xml:"showtitle"`
+	Actors     []nfoActor  `xml:"actor"`
+	Tags       []string    `xml:"tag"`
+	Genres     []string    `xml:"genre"`
+	Premiered  string      `xml:"premiered"`
+	Aired      string      `xml:"aired"`
+	Rating     string      `xml:"rating"`
+	UserRating string      `xml:"userrating"`
+	Ratings    []nfoRating `xml:"ratings>rating"`
+	FileInfo   struct {
+		Video struct {
+			Codec    string `xml:"codec"`
+			Width    int    `xml:"width"`
+			Height   int    `xml:"height"`
+			Duration int    `xml:"durationinseconds"`
+		} `xml:"streamdetails>video"`
+		Audio struct {
+			Codec string `xml:"codec"`
+		} `xml:"streamdetails>audio"`
+	} `xml:"fileinfo"`
+}
+
+type nfoActor struct {
+	Name  string `xml:"name"`
+	Thumb string `xml:"thumb"`
+}
+
+type nfoRating struct {
+	Name    string  `xml:"name,attr"`
+	Max     float64 `xml:"max,attr"`
+	Default bool    `xml:"default,attr"`
+	Value   float64 `xml:"value"`
+}
+
+func NewNFOSource(root string) (*NFOSource, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NFO root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("NFO root is not a directory: %s", root)
+	}
+
+	s := &NFOSource{root: root}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *NFOSource) Name() string {
+	return "nfo"
+}
+
+func (s *NFOSource) Tags() ([]SourceTag, error)             { return s.tags, nil }
+func (s *NFOSource) Studios() ([]SourceStudio, error)       { return s.studios, nil }
+func (s *NFOSource) Performers() ([]SourcePerformer, error) { return s.performers, nil }
+func (s *NFOSource) Scenes() ([]SourceScene, error)         { return s.scenes, nil }
+
+// Markers returns nothing; the NFO format has no equivalent.
+func (s *NFOSource) Markers() ([]SourceMarker, error) { return nil, nil }
+
+// load walks the tree once and builds all entity lists up front.
+func (s *NFOSource) load() error {
+	videosByDir := make(map[string][]string)
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Printf("[NFO]     WARNING: %v\n", err)
+			return nil
+		}
+		if !d.IsDir() && videoExtensions[strings.ToLower(filepath.Ext(path))] {
+			dir := filepath.Dir(path)
+			videosByDir[dir] = append(videosByDir[dir], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk NFO root: %w", err)
+	}
+
+	dirs := make([]string, 0, len(videosByDir))
+	for dir := range videosByDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	tagSeen := make(map[string]bool)
+	studioSeen := make(map[string]bool)
+	actorIndex := make(map[string]int)
+
+	for _, dir := range dirs {
+		videos := videosByDir[dir]
+		sort.Strings(videos)
+		for _, video := range videos {
+			nfoPath := sidecarPath(video, len(videos))
+			if nfoPath == "" {
+				continue
+			}
+			doc, err := parseNFO(nfoPath)
+			if err != nil {
+				fmt.Printf("[NFO]     WARNING: %v, skipping %s\n", err, video)
+				continue
+			}
+
+			scene, err := s.sceneFromNFO(video, doc)
+			if err != nil {
+				fmt.Printf("[NFO]     WARNING: %v, skipping %s\n", err, video)
+				continue
+			}
+
+			if scene.StudioID != "" && !studioSeen[scene.StudioID] {
+				studioSeen[scene.StudioID] = true
+				s.studios = append(s.studios, SourceStudio{ID: scene.StudioID, Name: nfoStudioName(doc)})
+			}
+			for _, a := range doc.Actors {
+				if strings.TrimSpace(a.Name) == "" {
+					continue
+				}
+				id := nameID("nfo", a.Name)
+				thumb := strings.TrimSpace(a.Thumb)
+				if i, ok := actorIndex[id]; ok {
+					// Not every NFO repeats the thumb; keep the first one we see.
+					if s.performers[i].ImageURL == "" {
+						s.performers[i].ImageURL = thumb
+					}
+					continue
+				}
+				actorIndex[id] = len(s.performers)
+				s.performers = append(s.performers, SourcePerformer{
+					ID:       id,
+					Name:     strings.TrimSpace(a.Name),
+					ImageURL: thumb,
+				})
+			}
+			for _, name := range nfoTagNames(doc) {
+				id := nameID("nfo", name)
+				if tagSeen[id] {
+					continue
+				}
+				tagSeen[id] = true
+				s.tags = append(s.tags, SourceTag{ID: id, Name: name})
+			}
+
+			s.scenes = append(s.scenes, scene)
+		}
+	}
+
+	return nil
+}
+
+func (s *NFOSource) sceneFromNFO(video string, doc *nfoDoc) (SourceScene, error) {
+	info, err := os.Stat(video)
+	if err != nil {
+		return SourceScene{}, fmt.Errorf("failed to stat video: %w", err)
+	}
+
+	v := doc.FileInfo.Video
+	scene := SourceScene{
+		ID:        "nfo:" + video,
+		Title:     strings.TrimSpace(doc.Title),
+		Details:   strings.TrimSpace(doc.Plot),
+		Date:      nfoDate(doc),
+		Rating100: nfoRating100(doc),
+		Files: []SourceFile{{
+			Path:       video,
+			Basename:   filepath.Base(video),
+			Size:       info.Size(),
+			Duration:   float64(v.Duration),
+			Width:      v.Width,
+			Height:     v.Height,
+			VideoCodec: v.Codec,
+			AudioCodec: doc.FileInfo.Audio.Codec,
+		}},
+	}
+	if scene.Details == "" {
+		scene.Details = strings.TrimSpace(doc.Outline)
+	}
+	if name := nfoStudioName(doc); name != "" {
+		scene.StudioID = nameID("nfo", name)
+	}
+	for _, a := range doc.Actors {
+		if strings.TrimSpace(a.Name) != "" {
+			scene.PerformerIDs = append(scene.PerformerIDs, nameID("nfo", a.Name))
+		}
+	}
+	for _, name := range nfoTagNames(doc) {
+		scene.TagIDs = append(scene.TagIDs, nameID("nfo", name))
+	}
+	return scene, nil
+}
+
+// sidecarPath returns the .nfo for a video, or "" if there isn't one.
+func sidecarPath(video string, videosInDir int) string {
+	candidate := strings.TrimSuffix(video, filepath.Ext(video)) + ".nfo"
+	if _, err := os.Stat(candidate); err == nil {
+		return candidate
+	}
+	if videosInDir == 1 {
+		candidate = filepath.Join(filepath.Dir(video), "movie.nfo")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func parseNFO(path string) (*nfoDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc nfoDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	switch doc.XMLName.Local {
+	case "movie", "episodedetails":
+	default:
+		return nil, fmt.Errorf("unsupported NFO root element <%s> in %s", doc.XMLName.Local, path)
+	}
+	return &doc, nil
+}
+
+func nfoStudioName(doc *nfoDoc) string {
+	for _, st := range doc.Studios {
+		if name := strings.TrimSpace(st); name != "" {
+			return name
+		}
+	}
+	if doc.XMLName.Local == "episodedetails" {
+		return strings.TrimSpace(doc.ShowTitle)
+	}
+	return ""
+}
+
+// nfoTagNames merges <tag> and <genre> entries, dropping blanks and case-insensitive duplicates.
+func nfoTagNames(doc *nfoDoc) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{doc.Tags, doc.Genres} {
+		for _, name := range list {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// nfoDate returns premiered (movies) or aired (episodes) if it's a valid YYYY-MM-DD date.
+func nfoDate(doc *nfoDoc) *string {
+	for _, d := range []string{doc.Premiered, doc.Aired} {
+		d = strings.TrimSpace(d)
+		if _, err := time.Parse("2006-01-02", d); err == nil {
+			return &d
+		}
+	}
+	return nil
+}
+
+// nfoRating100 converts the NFO rating to a 0-100 scale. The user's own rating wins,
+// then the default entry of <ratings>, then the legacy top-level <rating>.
+func nfoRating100(doc *nfoDoc) *int {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(doc.UserRating), 64); err == nil && v > 0 {
+		return scaleRating(v, 10)
+	}
+	for _, r := range doc.Ratings {
+		if r.Default || len(doc.Ratings) == 1 {
+			scale := r.Max
+			if scale <= 0 {
+				scale = 10
+			}
+			return scaleRating(r.Value, scale)
+		}
+	}
+	if v, err := strconv.ParseFloat(strings.TrimSpace(doc.Rating), 64); err == nil && v > 0 {
+		return scaleRating(v, 10)
+	}
+	return nil
+}
+
+func scaleRating(value, scale float64) *int {
+	r := max(0, min(100, int(math.Round(value/scale*100))))
+	return &r
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntityPair is one entity paired in IDMap, with the fields both sides share
+// normalised to Stash terms (Stash IDs, Stash enum values) so they compare directly.
+type EntityPair struct {
+	Kind         string // "tag", "performer" or "scene"
+	StashID      string
+	GHID         uint
+	Label        string
+	Stash        entityFields
+	GH           entityFields
+	StashUpdated time.Time
+	GHUpdated    time.Time
+	// Imported holds, by field, GoonHub values the importer derived from the
+	// Stash value that GH now shows instead; see matchImported.
+	Imported entityFields
+}
+
+// entityFields holds comparable field values as normalised strings. ID lists are
+// sorted and comma-joined so equal sets compare equal.
+type entityFields map[string]string
+
+// FieldChange is one differing field, with values formatted for display.
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// pairCollector fetches both sides of every IDMap pair. Stash is read through the
+// GraphQL client since callers go on to write to it.
+//
+// GoonHub values the importer derived rather than copied from Stash — a file
+// name as the title of an untitled scene, tag rule renames, field transforms and
+// parsed file names — are compared as the Stash value they came from, so they
+// aren't mistaken for GoonHub edits. The values are derived again from the
+// current Stash entity with the current rules files; values derived from an
+// earlier Stash value or with since-changed rules still show as edits.
+type pairCollector struct {
+	stash  *StashClient
+	gh     *GoonHubClient
+	idMap  *IDMap
+	since  time.Time
+	prefix string
+	// started is when the last Collect began, so callers can record a sync point
+	// that can't miss edits made while fetching.
+	started time.Time
+
+	rules importRules
+	// tagResolver applies the tag rules to Stash's tags; set by tags().
+	tagResolver *tagResolver
+
+	// stashToGHTags has every Stash tag GoonHub has, including tags merged into
+	// a mapped one; set by tags().
+	stashToGHTags    map[string]uint
+	ghToStashTags    map[uint][]string
+	ghToStashStudios map[uint][]string
+	ghToStashActors  map[uint][]string
+}
+
+func newPairCollector(stash *StashClient, gh *GoonHubClient, idMap *IDMap, rules importRules, since time.Time, prefix string) *pairCollector {
+	return &pairCollector{
+		stash:            stash,
+		gh:               gh,
+		idMap:            idMap,
+		rules:            rules,
+		since:            since,
+		prefix:           fmt.Sprintf("%-9s", "["+prefix+"]"),
+		ghToStashStudios: invert(idMap.Studios),
+		ghToStashActors:  invert(idMap.Actors),
+	}
+}
+
+// Collect returns every paired tag, performer and scene. GoonHub scenes and actors
+// last updated before since are left out. Tags come first: scenes need their
+// lookups.
+func (c *pairCollector) Collect() ([]EntityPair, error) {
+	c.started = time.Now()
+	fmt.Printf("\n%s Fetching paired entities from Stash and GoonHub...\n", c.prefix)
+
+	var pairs []EntityPair
+	for _, collect := range []func() ([]EntityPair, error){c.tags, c.performers, c.scenes} {
+		p, err := collect()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p...)
+	}
+	return pairs, nil
+}
+
+func (c *pairCollector) tags() ([]EntityPair, error) {
+	stashTags, err := c.stash.FetchTags()
+	if err != nil {
+		return nil, err
+	}
+	ghTags, err := c.gh.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	ghByID := make(map[uint]GHTag, len(ghTags))
+	for _, t := range ghTags {
+		ghByID[t.ID] = t.GHTag
+	}
+
+	// A tag merged into another by the tag rules is represented in GoonHub by
+	// the tag it was merged into.
+	if c.rules.tagRules.Len() > 0 {
+		c.tagResolver = c.rules.tagRules.Resolve(convertStashTags(stashTags), c.idMap.Tags)
+	}
+	c.stashToGHTags = make(map[string]uint, len(stashTags))
+	for _, t := range stashTags {
+		canon, keep := c.tagResolver.resolve(t.ID)
+		if ghID, ok := c.idMap.Tags[t.ID]; ok {
+			c.stashToGHTags[t.ID] = ghID
+		} else if ghID, ok := c.idMap.Tags[canon]; ok && keep {
+			c.stashToGHTags[t.ID] = ghID
+		}
+	}
+	c.ghToStashTags = invert(c.stashToGHTags)
+
+	var pairs []EntityPair
+	for _, t := range stashTags {
+		ghID, ok := c.idMap.Tags[t.ID]
+		if !ok {
+			continue
+		}
+		ghTag, ok := ghByID[ghID]
+		if !ok {
+			continue
+		}
+		p := EntityPair{
+			Kind: "tag", StashID: t.ID, GHID: ghID, Label: t.Name,
+			Stash: stashTagFields(t), GH: ghTagFields(ghTag),
+			StashUpdated: t.UpdatedAt, GHUpdated: ghTag.UpdatedAt,
+		}
+		p.matchImported(c.importedTag(t))
+		pairs = append(pairs, p)
+	}
+	fmt.Printf("%s Compared %d paired tags\n", c.prefix, len(pairs))
+	return pairs, nil
+}
+
+func (c *pairCollector) performers() ([]EntityPair, error) {
+	performers, err := c.stash.FetchPerformers()
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []EntityPair
+	for _, p := range performers {
+		ghID, ok := c.idMap.Actors[p.ID]
+		if !ok {
+			continue
+		}
+		actor, err := c.gh.GetActor(ghID)
+		if err != nil {
+			fmt.Printf("%s WARNING: performer %q (gh:%d): %v\n", c.prefix, p.Name, ghID, err)
+			continue
+		}
+		if c.before(actor.UpdatedAt) {
+			continue
+		}
+		pair := EntityPair{
+			Kind: "performer", StashID: p.ID, GHID: ghID, Label: p.Name,
+			Stash: stashPerformerFields(p), GH: ghActorFields(*actor),
+			StashUpdated: p.UpdatedAt, GHUpdated: actor.UpdatedAt,
+		}
+		pair.matchImported(c.importedPerformer(p))
+		pairs = append(pairs, pair)
+	}
+	fmt.Printf("%s Compared %d paired performers\n", c.prefix, len(pairs))
+	return pairs, nil
+}
+
+func (c *pairCollector) scenes() ([]EntityPair, error) {
+	scenes, err := c.stash.FetchScenes()
+	if err != nil {
+		return nil, err
+	}
+	imported, err := c.parseScenes(scenes)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []EntityPair
+	for i, sc := range scenes {
+		ghID, ok := c.idMap.Scenes[sc.ID]
+		if !ok {
+			continue
+		}
+		ghScene, err := c.gh.GetScene(ghID)
+		if err != nil {
+			fmt.Printf("%s WARNING: scene %s (gh:%d): %v\n", c.prefix, sc.ID, ghID, err)
+			continue
+		}
+		if c.before(ghScene.UpdatedAt) {
+			continue
+		}
+		label := derefStr(sc.Title)
+		if label == "" && len(sc.Files) > 0 {
+			label = sc.Files[0].Basename
+		}
+		p := EntityPair{
+			Kind: "scene", StashID: sc.ID, GHID: ghID, Label: label,
+			Stash: stashSceneFields(sc), GH: c.ghSceneFields(*ghScene, sc),
+			StashUpdated: sc.UpdatedAt, GHUpdated: ghScene.UpdatedAt,
+		}
+		p.matchImported(c.importedScene(sc, imported[i]))
+		pairs = append(pairs, p)
+	}
+	fmt.Printf("%s Compared %d paired scenes\n", c.prefix, len(pairs))
+	return pairs, nil
+}
+
+func (c *pairCollector) before(updatedAt time.Time) bool {
+	return !c.since.IsZero() && !updatedAt.IsZero() && updatedAt.Before(c.since)
+}
+
+// --- Importer-derived values ---
+
+// matchImported treats GoonHub values equal to what the importer would send for
+// the Stash entity as the Stash value, keeping the GoonHub value in p.Imported.
+func (p *EntityPair) matchImported(imported entityFields) {
+	for k, v := range imported {
+		if gv, ok := p.GH[k]; ok && gv == v && gv != p.Stash[k] {
+			if p.Imported == nil {
+				p.Imported = make(entityFields)
+			}
+			p.Imported[k] = gv
+			p.GH[k] = p.Stash[k]
+		}
+	}
+}
+
+// importedTag returns the name the importer would give a Stash tag.
+func (c *pairCollector) importedTag(t StashTag) entityFields {
+	canon, _ := c.tagResolver.resolve(t.ID)
+	tag := SourceTag{ID: t.ID, Name: t.Name}
+	req := GHCreateTagRequest{Name: c.tagResolver.name(SourceTag{ID: canon, Name: t.Name})}
+	if err := c.rules.transforms.Apply("Tags", &req, tag); err != nil {
+		return nil
+	}
+	return ghTagFields(GHTag{Name: req.Name})
+}
+
+// importedPerformer returns the fields the importer would send for a Stash
+// performer, in Stash terms.
+func (c *pairCollector) importedPerformer(p StashPerformer) entityFields {
+	perf := convertStashPerformers([]StashPerformer{p})[0]
+	req := actorRequest(perf)
+	if err := c.rules.transforms.Apply("Actors", &req, perf); err != nil {
+		return nil
+	}
+	return ghActorFields(GHActor{
+		Name:         req.Name,
+		Gender:       req.Gender,
+		Birthday:     req.Birthday,
+		DateOfDeath:  req.DateOfDeath,
+		Ethnicity:    req.Ethnicity,
+		Nationality:  req.Nationality,
+		HeightCm:     req.HeightCm,
+		WeightKg:     req.WeightKg,
+		Measurements: req.Measurements,
+		HairColor:    req.HairColor,
+		EyeColor:     req.EyeColor,
+		Tattoos:      req.Tattoos,
+		Piercings:    req.Piercings,
+	})
+}
+
+// parseScenes converts Stash scenes to source scenes and fills in untitled ones
+// from their file names, as the importer does.
+func (c *pairCollector) parseScenes(scenes []StashScene) ([]SourceScene, error) {
+	data := SourceData{Scenes: convertStashScenes(scenes)}
+	if c.rules.parser.Len() == 0 {
+		return data.Scenes, nil
+	}
+	studios, err := c.stash.FetchStudios()
+	if err != nil {
+		return nil, err
+	}
+	performers, err := c.stash.FetchPerformers()
+	if err != nil {
+		return nil, err
+	}
+	data.Studios = convertStashStudios(studios)
+	data.Performers = convertStashPerformers(performers)
+	c.rules.parser.Apply(&data)
+	return data.Scenes, nil
+}
+
+// importedScene returns the fields the importer would send for a Stash scene, in
+// Stash terms. parsed is the scene after filename parsing. Transforms see no
+// stored_path or storage_path_id: they depend on the path mappings.
+func (c *pairCollector) importedScene(sc StashScene, parsed SourceScene) entityFields {
+	if len(parsed.Files) == 0 {
+		return nil
+	}
+	req := sceneRequest(parsed, parsed.Files[0], "stash")
+	if id, ok := c.idMap.Studios[parsed.StudioID]; ok {
+		req.StudioID = &id
+	}
+	if err := c.rules.transforms.Apply("Scenes", &req, parsed); err != nil {
+		return nil
+	}
+
+	fields := entityFields{
+		"title":   req.Title,
+		"details": req.Description,
+		"date":    normDate(derefStr(req.ReleaseDate)),
+	}
+	// The parser only fills in a studio and performers the scene lacks.
+	if sc.Studio == nil && parsed.StudioID != "" {
+		fields["studio_id"] = parsed.StudioID
+	}
+	if len(sc.Performers) == 0 && len(parsed.PerformerIDs) > 0 {
+		var ids []string
+		for _, id := range parsed.PerformerIDs {
+			if _, ok := c.idMap.Actors[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		fields["performer_ids"] = idList(ids)
+	}
+	return fields
+}
+
+// --- Field normalisation ---
+
+func stashTagFields(t StashTag) entityFields {
+	return entityFields{"name": t.Name}
+}
+
+func ghTagFields(t GHTag) entityFields {
+	return entityFields{"name": t.Name}
+}
+
+func stashPerformerFields(p StashPerformer) entityFields {
+	return entityFields{
+		"name":         p.Name,
+		"gender":       strings.ToUpper(derefStr(p.Gender)),
+		"birthdate":    normDate(derefStr(p.Birthdate)),
+		"death_date":   normDate(derefStr(p.DeathDate)),
+		"ethnicity":    derefStr(p.Ethnicity),
+		"country":      derefStr(p.Country),
+		"eye_color":    derefStr(p.EyeColor),
+		"height_cm":    intField(p.HeightCm),
+		"measurements": derefStr(p.Measurements),
+		"tattoos":      derefStr(p.Tattoos),
+		"piercings":    derefStr(p.Piercings),
+		"hair_color":   derefStr(p.HairColor),
+		"weight":       intField(p.Weight),
+	}
+}
+
+func ghActorFields(a GHActor) entityFields {
+	return entityFields{
+		"name":         a.Name,
+		"gender":       strings.ToUpper(a.Gender),
+		"birthdate":    normDate(derefStr(a.Birthday)),
+		"death_date":   normDate(derefStr(a.DateOfDeath)),
+		"ethnicity":    a.Ethnicity,
+		"country":      a.Nationality,
+		"eye_color":    a.EyeColor,
+		"height_cm":    intField(a.HeightCm),
+		"measurements": a.Measurements,
+		"tattoos":      a.Tattoos,
+		"piercings":    a.Piercings,
+		"hair_color":   a.HairColor,
+		"weight":       intField(a.WeightKg),
+	}
+}
+
+func stashSceneFields(sc StashScene) entityFields {
+	return entityFields{
+		"title":         derefStr(sc.Title),
+		"details":       derefStr(sc.Details),
+		"date":          normDate(derefStr(sc.Date)),
+		"studio_id":     refID(sc.Studio),
+		"tag_ids":       idList(refIDs(sc.Tags)),
+		"performer_ids": idList(refIDs(sc.Performers)),
+	}
+}
+
+// ghSceneFields translates a GoonHub scene into Stash terms. References GoonHub has
+// that Stash doesn't know about are dropped, and Stash references that were never
+// imported are kept, so writing back never removes data GoonHub can't see. A
+// GoonHub reference shared by several Stash IDs becomes the ones the Stash scene
+// already has, else the first of them.
+func (c *pairCollector) ghSceneFields(s GHScene, stashScene StashScene) entityFields {
+	studioID := refID(stashScene.Studio)
+	if s.StudioID != nil {
+		if ids := pickStashIDs(c.ghToStashStudios[*s.StudioID], []string{studioID}); len(ids) > 0 {
+			studioID = ids[0]
+		}
+	} else if _, mapped := c.idMap.Studios[studioID]; mapped {
+		studioID = ""
+	}
+
+	stashTags := refIDs(stashScene.Tags)
+	var tagIDs []string
+	for _, t := range s.Tags {
+		tagIDs = append(tagIDs, pickStashIDs(c.ghToStashTags[t.ID], stashTags)...)
+	}
+	for _, id := range stashTags {
+		if _, mapped := c.stashToGHTags[id]; !mapped {
+			tagIDs = append(tagIDs, id)
+		}
+	}
+
+	stashPerformers := refIDs(stashScene.Performers)
+	var performerIDs []string
+	for _, a := range s.Actors {
+		performerIDs = append(performerIDs, pickStashIDs(c.ghToStashActors[a.ID], stashPerformers)...)
+	}
+	for _, id := range stashPerformers {
+		if _, mapped := c.idMap.Actors[id]; !mapped {
+			performerIDs = append(performerIDs, id)
+		}
+	}
+
+	return entityFields{
+		"title":         s.Title,
+		"details":       s.Description,
+		"date":          normDate(derefStr(s.ReleaseDate)),
+		"studio_id":     studioID,
+		"tag_ids":       idList(tagIDs),
+		"performer_ids": idList(performerIDs),
+	}
+}
+
+// pickStashIDs chooses among the Stash IDs behind one GoonHub ID: those in have,
+// or else the first.
+func pickStashIDs(ids, have []string) []string {
+	var out []string
+	for _, id := range ids {
+		for _, h := range have {
+			if id == h {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	if len(out) == 0 && len(ids) > 0 {
+		out = ids[:1]
+	}
+	return out
+}
+
+// stashUpdateInput builds a Stash update mutation input from Stash-terms field values.
+func stashUpdateInput(stashID string, fields entityFields) map[string]any {
+	input := map[string]any{"id": stashID}
+	for field, v := range fields {
+		switch field {
+		case "height_cm", "weight":
+			if n, err := strconv.Atoi(v); err == nil {
+				input[field] = n
+			} else {
+				input[field] = nil
+			}
+		case "tag_ids", "performer_ids":
+			input[field] = splitList(v, ",")
+			if v == "" {
+				input[field] = []string{}
+			}
+		default:
+			if v == "" {
+				input[field] = nil
+			} else {
+				input[field] = v
+			}
+		}
+	}
+	return input
+}
+
+// --- Diff helpers ---
+
+func diffFields(from, to entityFields) []FieldChange {
+	keys := make([]string, 0, len(to))
+	for k := range to {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changes []FieldChange
+	for _, k := range keys {
+		if from[k] != to[k] {
+			changes = append(changes, FieldChange{Field: k, From: from[k], To: to[k]})
+		}
+	}
+	return changes
+}
+
+// normDate trims timestamps like "2024-03-15T00:00:00Z" to the date part.
+func normDate(s string) string {
+	if len(s) > 10 && s[4] == '-' && s[7] == '-' {
+		return s[:10]
+	}
+	return s
+}
+
+func intField(n *int) string {
+	if n == nil || *n == 0 {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func idList(ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	var out []string
+	for _, id := range sorted {
+		if len(out) == 0 || id != out[len(out)-1] {
+			out = append(out, id)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
@@ -2,34 +2,127 @@ package main
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
 )
 
+// PathMapper translates Stash paths to GoonHub paths. Paths and prefixes are
+// normalised first (see normalizePath), so Windows, UNC and POSIX paths all
+// map the same way. Regex mappings are tried first, in file order; then the
+// longest matching prefix wins.
 type PathMapper struct {
-	mappings []PathMapping
+	regexes  []regexMapping
+	prefixes []prefixMapping
 }
 
-func NewPathMapper(mappings []PathMapping) *PathMapper {
-	return &PathMapper{mappings: mappings}
+type regexMapping struct {
+	re *regexp.Regexp
+	PathMapping
+}
+
+type prefixMapping struct {
+	prefix string // normalised StashPrefix
+	PathMapping
+}
+
+func NewPathMapper(mappings []PathMapping) (*PathMapper, error) {
+	pm := &PathMapper{}
+	for _, m := range mappings {
+		if m.StashRegex == "" {
+			pm.prefixes = append(pm.prefixes, prefixMapping{prefix: normalizePath(m.StashPrefix), PathMapping: m})
+			continue
+		}
+		expr := m.StashRegex
+		if m.CaseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stash_regex %q: %w", m.StashRegex, err)
+		}
+		pm.regexes = append(pm.regexes, regexMapping{re: re, PathMapping: m})
+	}
+	sort.SliceStable(pm.prefixes, func(i, j int) bool {
+		return len(pm.prefixes[i].prefix) > len(pm.prefixes[j].prefix)
+	})
+	return pm, nil
 }
 
 type MappedPath struct {
 	GoonHubPath   string
 	StoragePathID uint
+	// Mapping is the mapping that matched.
+	Mapping PathMapping
 }
 
-// MapPath translates a Stash file path to a GoonHub path using configured prefix mappings.
-// Returns the mapped path and storage path ID, or an error if no mapping matches.
+// MapPath translates a Stash file path to a GoonHub path using configured mappings.
+// Returns the mapped path, always with forward slashes, and storage path ID, or an
+// error if no mapping matches.
 func (pm *PathMapper) MapPath(stashPath string) (*MappedPath, error) {
-	for _, m := range pm.mappings {
-		if strings.HasPrefix(stashPath, m.StashPrefix) {
-			remainder := stashPath[len(m.StashPrefix):]
-			ghPath := strings.TrimRight(m.GoonHubPrefix, "/") + "/" + strings.TrimLeft(remainder, "/")
+	p := normalizePath(stashPath)
+
+	for _, m := range pm.regexes {
+		loc := m.re.FindStringSubmatchIndex(p)
+		if loc == nil {
+			continue
+		}
+		ghPath := m.re.ExpandString(nil, m.GoonHubPath, p, loc)
+		return &MappedPath{
+			GoonHubPath:   strings.ReplaceAll(p[:loc[0]]+string(ghPath)+p[loc[1]:], `\`, "/"),
+			StoragePathID: m.StoragePathID,
+			Mapping:       m.PathMapping,
+		}, nil
+	}
+
+	for _, m := range pm.prefixes {
+		if hasPathPrefix(p, m.prefix, m.CaseInsensitive) {
+			remainder := p[len(m.prefix):]
+			ghPrefix := strings.ReplaceAll(m.GoonHubPrefix, `\`, "/")
+			ghPath := strings.TrimRight(ghPrefix, "/") + "/" + strings.TrimLeft(remainder, "/")
 			return &MappedPath{
 				GoonHubPath:   ghPath,
 				StoragePathID: m.StoragePathID,
+				Mapping:       m.PathMapping,
 			}, nil
 		}
 	}
 	return nil, fmt.Errorf("no path mapping found for: %s", stashPath)
 }
+
+// hasPathPrefix reports whether prefix is path or a parent directory of it, so
+// /data matches /data/x but not /database/x.
+func hasPathPrefix(path, prefix string, caseInsensitive bool) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	if caseInsensitive {
+		if !strings.EqualFold(path[:len(prefix)], prefix) {
+			return false
+		}
+	} else if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// normalizePath converts Windows (D:\Videos\a.mp4), UNC (\\nas\share\a.mp4) and
+// POSIX paths to one form: forward slashes, no repeated separators or . and ..
+// segments, no trailing slash, and upper-case drive letters. UNC paths keep
+// their leading "//".
+func normalizePath(p string) string {
+	if p == "" {
+		return p
+	}
+	p = strings.ReplaceAll(p, `\`, "/")
+	unc := strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "///")
+	p = path.Clean(p)
+	if unc {
+		p = "/" + p
+	}
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0] && p[0] <= 'z') {
+		p = strings.ToUpper(p[:1]) + p[1:]
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+package main
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"posix", "/data/videos/a.mp4", "/data/videos/a.mp4"},
+		{"posix trailing slash", "/data/videos/", "/data/videos"},
+		{"posix repeated separators and dots", "/data//videos/./x/../a.mp4", "/data/videos/a.mp4"},
+		{"windows drive", `D:\Videos\a.mp4`, "D:/Videos/a.mp4"},
+		{"windows lower-case drive", `d:\Videos\a.mp4`, "D:/Videos/a.mp4"},
+		{"windows mixed separators", `D:\Videos/sub\a.mp4`, "D:/Videos/sub/a.mp4"},
+		{"unc", `\\nas\share\Videos\a.mp4`, "//nas/share/Videos/a.mp4"},
+		{"unc trailing separator", `\\nas\share\`, "//nas/share"},
+		{"triple slash is not unc", "///data/a.mp4", "/data/a.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePath(tt.in); got != tt.want {
+				t.Errorf("normalizePath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		name            string
+		path, prefix    string
+		caseInsensitive bool
+		want            bool
+	}{
+		{"same path", "/data", "/data", false, true},
+		{"child", "/data/x.mp4", "/data", false, true},
+		{"segment boundary", "/database/x.mp4", "/data", false, false},
+		{"root prefix", "/data/x.mp4", "/", false, true},
+		{"shorter path", "/da", "/data", false, false},
+		{"case differs", "/Data/x.mp4", "/data", false, false},
+		{"case differs, insensitive", "/Data/x.mp4", "/data", true, true},
+		{"segment boundary, insensitive", "/DATABASE/x.mp4", "/data", true, false},
+		{"windows drive", "D:/Videos/a.mp4", "D:/Videos", false, true},
+		{"unc share", "//nas/share/a.mp4", "//nas/share", false, true},
+		{"unc other share", "//nas/shared/a.mp4", "//nas/share", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasPathPrefix(tt.path, tt.prefix, tt.caseInsensitive); got != tt.want {
+				t.Errorf("hasPathPrefix(%q, %q, %v) = %v, want %v", tt.path, tt.prefix, tt.caseInsensitive, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapPath(t *testing.T) {
+	mappings := []PathMapping{
+		{StashPrefix: "/data", GoonHubPrefix: "/media/data", StoragePathID: 1},
+		{StashPrefix: "/data/videos", GoonHubPrefix: "/media/videos", StoragePathID: 2},
+		{StashPrefix: `D:\Videos`, GoonHubPrefix: "/mnt/d", StoragePathID: 3},
+		{StashPrefix: `\\nas\share`, GoonHubPrefix: `\\goonhub\nas\`, StoragePathID: 4},
+		{StashPrefix: "/Library/Movies", GoonHubPrefix: "/movies", CaseInsensitive: true},
+		{StashRegex: `^/regex/(\w+)/(.*)$`, GoonHubPath: "/by-studio/$1/$2", StoragePathID: 5},
+	}
+	pm, err := NewPathMapper(mappings)
+	if err != nil {
+		t.Fatalf("NewPathMapper: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		storageID uint
+		wantErr   bool
+	}{
+		{"posix", "/data/other/a.mp4", "/media/data/other/a.mp4", 1, false},
+		{"longest prefix wins", "/data/videos/a.mp4", "/media/videos/a.mp4", 2, false},
+		{"segment boundary", "/database/a.mp4", "", 0, true},
+		{"posix unclean", "/data//videos/../other/./a.mp4", "/media/data/other/a.mp4", 1, false},
+		{"windows drive", `D:\Videos\Studio\a.mp4`, "/mnt/d/Studio/a.mp4", 3, false},
+		{"windows lower-case drive", `d:\Videos\a.mp4`, "/mnt/d/a.mp4", 3, false},
+		{"windows forward slashes", "D:/Videos/a.mp4", "/mnt/d/a.mp4", 3, false},
+		{"windows case differs", `D:\videos\a.mp4`, "", 0, true},
+		{"unc", `\\nas\share\Clips\a.mp4`, "//goonhub/nas/Clips/a.mp4", 4, false},
+		{"unc other share", `\\nas\shared\a.mp4`, "", 0, true},
+		{"case insensitive", "/library/MOVIES/a.mp4", "/movies/a.mp4", 0, false},
+		{"case insensitive boundary", "/library/moviesx/a.mp4", "", 0, true},
+		{"regex", "/regex/acme/sub/a.mp4", "/by-studio/acme/sub/a.mp4", 5, false},
+		{"no mapping", "/elsewhere/a.mp4", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pm.MapPath(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("MapPath(%q) = %q, want an error", tt.in, got.GoonHubPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MapPath(%q): %v", tt.in, err)
+			}
+			if got.GoonHubPath != tt.want || got.StoragePathID != tt.storageID {
+				t.Errorf("MapPath(%q) = %q (storage %d), want %q (storage %d)", tt.in, got.GoonHubPath, got.StoragePathID, tt.want, tt.storageID)
+			}
+		})
+	}
+}
+
+func TestMapPathRegexCaseInsensitive(t *testing.T) {
+	pm, err := NewPathMapper([]PathMapping{
+		{StashRegex: `^D:/Videos/(.*)$`, GoonHubPath: "/mnt/d/$1", CaseInsensitive: true},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMapper: %v", err)
+	}
+	got, err := pm.MapPath(`d:\VIDEOS\Sub\a.mp4`)
+	if err != nil {
+		t.Fatalf("MapPath: %v", err)
+	}
+	if want := "/mnt/d/Sub/a.mp4"; got.GoonHubPath != want {
+		t.Errorf("MapPath = %q, want %q", got.GoonHubPath, want)
+	}
+}
+
+func TestNewPathMapperInvalidRegex(t *testing.T) {
+	if _, err := NewPathMapper([]PathMapping{{StashRegex: "(", GoonHubPath: "/x"}}); err == nil {
+		t.Error("NewPathMapper accepted an invalid stash_regex")
+	}
+}
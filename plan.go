@@ -0,0 +1,582 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const planVersion = 1
+
+// ImportPlan is a reviewable record of everything an import would do. Entities the
+// plan creates don't have GoonHub IDs yet, so steps refer to them by source ID
+// (Refs) and apply resolves those through id_map.json as it goes.
+type ImportPlan struct {
+	Version     int             `json:"version"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Source      string          `json:"source"`
+	GoonHub     string          `json:"goonhub"`
+	Fingerprint PlanFingerprint `json:"fingerprint"`
+	Scope       *ImportScope    `json:"scope,omitempty"`
+	Steps       []PlanStep      `json:"steps"`
+}
+
+// PlanFingerprint hashes the state a plan was made against. Apply refuses to run
+// if any of them has changed.
+type PlanFingerprint struct {
+	Source  string `json:"source"`
+	GoonHub string `json:"goonhub"`
+	IDMap   string `json:"id_map"`
+}
+
+// PlanStep is one decision. Action is "create", "reuse", "update", "link" or "skip".
+type PlanStep struct {
+	Phase    string              `json:"phase"`
+	Action   string              `json:"action"`
+	SourceID string              `json:"source_id"`
+	Label    string              `json:"label,omitempty"`
+	GHID     uint                `json:"gh_id,omitempty"`
+	Reason   string              `json:"reason,omitempty"`
+	Request  json.RawMessage     `json:"request,omitempty"`
+	Refs     map[string][]string `json:"refs,omitempty"`
+}
+
+// SourceData is everything fetched from a source for one run.
+type SourceData struct {
+	Tags       []SourceTag
+	Studios    []SourceStudio
+	Performers []SourcePerformer
+	Scenes     []SourceScene
+	Markers    []SourceMarker
+
+	SavedFilters []SourceSavedFilter
+}
+
+// FetchSourceData reads every entity from the source, fills in untitled scenes
+// with parser, narrows it to scope (if any) and then applies SCENE_LIMIT.
+func FetchSourceData(source Source, scope *ImportScope, parser *FilenameParser, sceneLimit int) (*SourceData, error) {
+	fmt.Printf("\n[Source]  Fetching data from %s...\n", source.Name())
+
+	var data SourceData
+	var err error
+	if data.Tags, err = source.Tags(); err != nil {
+		return nil, fmt.Errorf("failed to fetch tags: %w", err)
+	}
+	fmt.Printf("[Source]  Found %d tags\n", len(data.Tags))
+
+	if data.Studios, err = source.Studios(); err != nil {
+		return nil, fmt.Errorf("failed to fetch studios: %w", err)
+	}
+	fmt.Printf("[Source]  Found %d studios\n", len(data.Studios))
+
+	if data.Performers, err = source.Performers(); err != nil {
+		return nil, fmt.Errorf("failed to fetch performers: %w", err)
+	}
+	fmt.Printf("[Source]  Found %d performers\n", len(data.Performers))
+
+	if scope != nil && scope.SavedFilter != "" {
+		saved, ok := source.(SavedFilterSource)
+		if !ok {
+			return nil, fmt.Errorf("source %s doesn't support saved filters", source.Name())
+		}
+		if data.Scenes, err = saved.SavedFilterScenes(scope.SavedFilter); err != nil {
+			return nil, err
+		}
+	} else if data.Scenes, err = source.Scenes(); err != nil {
+		return nil, fmt.Errorf("failed to fetch scenes: %w", err)
+	}
+	fmt.Printf("[Source]  Found %d scenes\n", len(data.Scenes))
+
+	if data.Markers, err = source.Markers(); err != nil {
+		return nil, fmt.Errorf("failed to fetch markers: %w", err)
+	}
+
+	parser.Apply(&data)
+	data = *scope.Apply(&data)
+
+	// Saved filters are migrated by whole-library imports only.
+	if saved, ok := source.(SavedFilterSource); ok && !scope.FiltersScenes() && scope.RunsPhase("Searches") {
+		if data.SavedFilters, err = saved.SavedFilters(); err != nil {
+			return nil, fmt.Errorf("failed to fetch saved filters: %w", err)
+		}
+		fmt.Printf("[Source]  Found %d saved scene filters\n", len(data.SavedFilters))
+	}
+
+	if sceneLimit > 0 && len(data.Scenes) > sceneLimit {
+		fmt.Printf("[Source]  Limiting to %d scenes (SCENE_LIMIT)\n", sceneLimit)
+		data.Scenes = data.Scenes[:sceneLimit]
+		data.Markers = markersForScenes(data.Markers, data.Scenes)
+	}
+	fmt.Printf("[Source]  Found %d scene markers\n", len(data.Markers))
+	return &data, nil
+}
+
+// RunPhases runs the five import phases (or those selected by the scope), saving
+// the ID map after each one unless nothing is being written.
+func (imp *Importer) RunPhases(data *SourceData) map[string]PhaseStats {
+	allStats := make(map[string]PhaseStats)
+	run := func(phase string, importPhase func() PhaseStats) {
+		if !imp.scope.RunsPhase(phase) {
+			fmt.Printf("\n%-9s Skipping phase (not selected with --phases)\n", "["+phase+"]")
+			return
+		}
+		allStats[phase] = importPhase()
+		if !imp.dryRun() {
+			imp.savePhase(phase)
+		}
+	}
+
+	run("Tags", func() PhaseStats { return imp.ImportTags(data.Tags) })
+	run("Studios", func() PhaseStats { return imp.ImportStudios(data.Studios) })
+	run("Actors", func() PhaseStats { return imp.ImportPerformers(data.Performers) })
+	run("Scenes", func() PhaseStats { return imp.ImportScenes(data.Scenes) })
+	run("Markers", func() PhaseStats { return imp.ImportMarkers(data.Markers) })
+	if _, ok := imp.source.(SavedFilterSource); ok {
+		run("Searches", func() PhaseStats { return imp.ImportSavedSearches(data.SavedFilters) })
+	}
+	return allStats
+}
+
+// --- Recording ---
+
+// dryRun reports whether phases should describe their work instead of doing it.
+func (imp *Importer) dryRun() bool {
+	return imp.cfg.DryRun || imp.plan != nil
+}
+
+func (imp *Importer) record(step PlanStep) {
+	if imp.plan != nil {
+		imp.plan.Steps = append(imp.plan.Steps, step)
+	}
+}
+
+// recordCreate records a create step with the request that would be sent, and
+// marks the entity as planned so later phases can link to it. If the request
+// can't be encoded the entity is recorded as skipped instead and the error is
+// returned.
+func (imp *Importer) recordCreate(phase, sourceID, label string, req any, refs map[string][]string) error {
+	if imp.plan != nil {
+		body, err := json.Marshal(req)
+		if err != nil {
+			err = fmt.Errorf("failed to marshal %s request: %w", strings.ToLower(phase), err)
+			imp.record(PlanStep{Phase: phase, Action: "skip", SourceID: sourceID, Label: label, Reason: err.Error()})
+			return err
+		}
+		if len(refs) == 0 {
+			refs = nil
+		}
+		imp.record(PlanStep{Phase: phase, Action: "create", SourceID: sourceID, Label: label, Request: body, Refs: refs})
+	}
+	imp.planned[phase+":"+sourceID] = true
+	return nil
+}
+
+// --- Fingerprints ---
+
+// fingerprint hashes the source data with the tag rules and transforms, the
+// GoonHub entities PreFetchExisting saw and the ID map. Call it after
+// PreFetchExisting and before any phase runs.
+func (imp *Importer) fingerprint(data *SourceData) (PlanFingerprint, error) {
+	src, err := hashJSON(struct {
+		Data       *SourceData
+		TagRules   *TagRules
+		Transforms *Transforms
+	}{data, imp.tagRules, imp.transforms})
+	if err != nil {
+		return PlanFingerprint{}, err
+	}
+	idMap, err := hashJSON(imp.idMap)
+	if err != nil {
+		return PlanFingerprint{}, err
+	}
+
+	var lines []string
+	for kind, m := range map[string]map[string]uint{"tag": imp.ghTags, "studio": imp.ghStudios, "actor": imp.ghActors} {
+		for name, id := range m {
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%d", kind, name, id))
+		}
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return PlanFingerprint{Source: src, GoonHub: hex.EncodeToString(sum[:]), IDMap: idMap}, nil
+}
+
+func hashJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash state: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// drift lists which parts of the state differ from the plan's.
+func (f PlanFingerprint) drift(current PlanFingerprint) []string {
+	var changed []string
+	if f.Source != current.Source {
+		changed = append(changed, "source data/tag rules/transforms")
+	}
+	if f.GoonHub != current.GoonHub {
+		changed = append(changed, "GoonHub tags/studios/actors")
+	}
+	if f.IDMap != current.IDMap {
+		changed = append(changed, "id map")
+	}
+	return changed
+}
+
+// --- Plan file ---
+
+func LoadPlan(path string) (*ImportPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan ImportPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d (expected %d)", plan.Version, planVersion)
+	}
+	return &plan, nil
+}
+
+func (p *ImportPlan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// --- Commands ---
+
+func runPlan(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	out := fs.String("out", "import-plan.json", "file to write the plan to")
+	scope := addScopeFlags(fs)
+	_ = fs.Parse(args)
+
+	imp, data := mustPrepareImport(cfg, scope)
+	fp, err := imp.fingerprint(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Plan error: %v\n", err)
+		os.Exit(1)
+	}
+	imp.plan = &ImportPlan{
+		Version:     planVersion,
+		CreatedAt:   time.Now().UTC(),
+		Source:      imp.source.Name(),
+		GoonHub:     cfg.GoonHubBaseURL,
+		Fingerprint: fp,
+		Scope:       scope,
+	}
+
+	allStats := imp.RunPhases(data)
+	if err := imp.plan.Save(*out); err != nil {
+		fmt.Fprintf(os.Stderr, "Plan error: %v\n", err)
+		os.Exit(1)
+	}
+
+	printSummary("Plan", allStats)
+	fmt.Printf("\nWrote %d steps to %s. Review it, then run: apply --plan %s\n", len(imp.plan.Steps), *out, *out)
+}
+
+func runApply(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	planFile := fs.String("plan", "import-plan.json", "plan file written by the plan command")
+	_ = fs.Parse(args)
+
+	if cfg.DryRun {
+		fmt.Fprintln(os.Stderr, "apply writes to GoonHub; unset DRY_RUN to use it")
+		os.Exit(2)
+	}
+	plan, err := LoadPlan(*planFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Plan error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[Config]  Plan:    %s (%d steps, made %s)\n", *planFile, len(plan.Steps), plan.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	if plan.GoonHub != cfg.GoonHubBaseURL {
+		fmt.Fprintf(os.Stderr, "Plan was made against GoonHub %s, not %s\n", plan.GoonHub, cfg.GoonHubBaseURL)
+		os.Exit(1)
+	}
+
+	// Re-read the source the way the plan did so the fingerprints compare like for like.
+	imp, data := mustPrepareImport(cfg, plan.Scope)
+	if plan.Source != imp.source.Name() {
+		fmt.Fprintf(os.Stderr, "Plan was made from source %q, not %q\n", plan.Source, imp.source.Name())
+		os.Exit(1)
+	}
+	fp, err := imp.fingerprint(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Plan error: %v\n", err)
+		os.Exit(1)
+	}
+	if changed := plan.Fingerprint.drift(fp); len(changed) > 0 {
+		fmt.Fprintf(os.Stderr, "Refusing to apply: %s changed since the plan was made. Run plan again.\n", strings.Join(changed, ", "))
+		os.Exit(1)
+	}
+	fmt.Println("[Apply]   State matches the plan")
+	imp.journal = mustStartJournal(cfg, "apply", imp.source.Name())
+	imp.idMap.RunID = imp.journal.ID
+	defer imp.journal.Close()
+	imp.failures = mustLoadFailures(cfg)
+
+	allStats := imp.ApplyPlan(plan)
+	imp.journal.Finished(allStats)
+	printSummary("Apply", allStats)
+	printReindexHint(cfg, allStats)
+	fmt.Printf("\nRun %s journaled to %s (undo with: rollback %s)\n", imp.journal.ID, imp.journal.Path, imp.journal.ID)
+	if totalErrors(allStats) > 0 {
+		imp.journal.Close()
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// --- Apply ---
+
+// ApplyPlan executes the plan's steps in order. The ID map is saved whenever a
+// phase finishes, like a normal import.
+func (imp *Importer) ApplyPlan(plan *ImportPlan) map[string]PhaseStats {
+	allStats := make(map[string]PhaseStats)
+	total := len(plan.Steps)
+	imp.applied = make(map[string]bool)
+	fmt.Printf("\n[Apply]   Executing %d steps...\n", total)
+
+	phase := ""
+	for i, step := range plan.Steps {
+		if step.Phase != phase {
+			if phase != "" {
+				imp.savePhase(phase)
+			}
+			phase = step.Phase
+		}
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		imp.checkpoint()
+		stats := allStats[step.Phase]
+
+		imp.journal.Begin()
+		if len(step.Request) > 0 {
+			imp.journal.Request(step.Request)
+		}
+		ghID, err := imp.applyStep(step)
+		switch {
+		case errors.Is(err, errNotCreated):
+			fmt.Printf("[Apply]   %s %s %s %q: skipped (%v)\n", idx, step.Phase, step.Action, step.Label, err)
+			imp.skipped(step.Phase, step.SourceID, 0, err.Error())
+			stats.Skipped++
+		case err != nil && isConflict(err):
+			fmt.Printf("[Apply]   %s %s %s %q: skipped (conflict/already exists)\n", idx, step.Phase, step.Action, step.Label)
+			imp.skipped(step.Phase, step.SourceID, 0, "conflict/already exists")
+			stats.Skipped++
+		case err != nil:
+			fmt.Printf("[Apply]   %s %s %s %q: ERROR %v\n", idx, step.Phase, step.Action, step.Label, err)
+			imp.failed(step.Phase, step.SourceID, err)
+			stats.Errors++
+		case step.Action == "create":
+			fmt.Printf("[Apply]   %s %s created %q (%s -> gh:%d)\n", idx, step.Phase, step.Label, imp.sourceRef(step.SourceID), ghID)
+			stats.Created++
+		case step.Action == "skip" || step.Action == "reuse":
+			stats.Skipped++
+		case step.Action == "update":
+			stats.Updated++
+		}
+		allStats[step.Phase] = stats
+	}
+	if phase != "" {
+		imp.savePhase(phase)
+	}
+	return allStats
+}
+
+// savePhase saves the ID map and failure list after a phase.
+func (imp *Importer) savePhase(phase string) {
+	if err := imp.idMap.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to save id map after %s: %v\n", strings.ToLower(phase), err)
+	}
+	imp.sinceSave, imp.lastSave = 0, time.Now()
+	imp.failures.ResolveMapped(phase, imp.idMap.forPhase(phase))
+	if err := imp.failures.Save(imp.cfg.FailuresFile); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to save failure list after %s: %v\n", strings.ToLower(phase), err)
+	}
+}
+
+// checkpoint saves the ID map every CheckpointEvery entities or CheckpointPeriod
+// within a phase, so a crash mid-phase loses little of what was imported. It is
+// called before each entity, so the save covers the ones before it.
+func (imp *Importer) checkpoint() {
+	if imp.dryRun() {
+		return
+	}
+	imp.sinceSave++
+	if imp.sinceSave <= imp.cfg.CheckpointEvery && time.Since(imp.lastSave) < imp.cfg.CheckpointPeriod {
+		return
+	}
+	if err := imp.idMap.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to checkpoint id map: %v\n", err)
+	}
+	imp.sinceSave, imp.lastSave = 0, time.Now()
+}
+
+// errNotCreated is returned for link steps whose entity this apply didn't
+// create, such as a scene mapped to an existing GoonHub scene on conflict. Its
+// tags and actors are left as they are.
+var errNotCreated = errors.New("not created by this apply, leaving its links unchanged")
+
+// applyStep executes one step and returns the GoonHub ID it created, if any.
+func (imp *Importer) applyStep(step PlanStep) (uint, error) {
+	ids := imp.idMap.forPhase(step.Phase)
+	if ids == nil {
+		return 0, fmt.Errorf("unknown phase %q", step.Phase)
+	}
+
+	switch step.Action {
+	case "skip":
+		return 0, nil
+	case "reuse":
+		ids[step.SourceID] = step.GHID
+		imp.journal.Mapped(step.Phase, step.SourceID, step.GHID)
+		return 0, nil
+	case "create":
+		id, err := imp.applyCreate(step)
+		if err != nil {
+			var conflictErr *ConflictError
+			if errors.As(err, &conflictErr) && conflictErr.ExistingID > 0 && step.Phase == "Scenes" {
+				ids[step.SourceID] = conflictErr.ExistingID
+				imp.journal.Mapped(step.Phase, step.SourceID, conflictErr.ExistingID)
+			}
+			return 0, err
+		}
+		ids[step.SourceID] = id
+		imp.applied[step.Phase+":"+step.SourceID] = true
+		imp.journal.Created(step.Phase, step.SourceID, id)
+		return id, nil
+	}
+	if step.Action == "link" && !imp.applied[step.Phase+":"+step.SourceID] {
+		return 0, errNotCreated
+	}
+
+	ghID, ok := ids[step.SourceID]
+	if !ok {
+		return 0, fmt.Errorf("%s %s was not created", strings.ToLower(step.Phase), imp.sourceRef(step.SourceID))
+	}
+	switch {
+	case step.Action == "update" && step.Phase == "Studios":
+		parentID, ok := imp.idMap.Studios[firstRef(step.Refs, "parent")]
+		if !ok {
+			return 0, fmt.Errorf("parent studio was not created")
+		}
+		return 0, imp.setStudioParent(step.SourceID, ghID, parentID)
+	case step.Action == "link" && step.Phase == "Scenes" && step.Refs["tags"] != nil:
+		return 0, imp.link(step, "tags", imp.gh.SetSceneTags(ghID, imp.mapTagIDs(step.Refs["tags"])))
+	case step.Action == "link" && step.Phase == "Scenes" && step.Refs["actors"] != nil:
+		return 0, imp.link(step, "actors", imp.gh.SetSceneActors(ghID, imp.mapActorIDs(step.Refs["actors"])))
+	case step.Action == "link" && step.Phase == "Markers":
+		return 0, imp.link(step, "tags", imp.gh.SetMarkerTags(ghID, imp.mapTagIDs(step.Refs["tags"])))
+	}
+	return 0, fmt.Errorf("unsupported %s step %q", step.Phase, step.Action)
+}
+
+// link journals a successful link step. applyStep only runs links for entities
+// this apply created, so there is no previous value to keep.
+func (imp *Importer) link(step PlanStep, field string, err error) error {
+	if err == nil {
+		imp.journal.Associated(step.Phase, step.SourceID, imp.idMap.forPhase(step.Phase)[step.SourceID], field, nil)
+	}
+	return err
+}
+
+func (imp *Importer) applyCreate(step PlanStep) (uint, error) {
+	switch step.Phase {
+	case "Tags":
+		var req GHCreateTagRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		created, err := imp.gh.CreateTag(req.Name, req.Color)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	case "Studios":
+		var req GHCreateStudioRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		created, err := imp.gh.CreateStudio(req)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	case "Actors":
+		var req GHCreateActorRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		created, err := imp.gh.CreateActor(req)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	case "Scenes":
+		var req GHImportSceneRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		if studioID, ok := imp.idMap.Studios[firstRef(step.Refs, "studio")]; ok {
+			req.StudioID = &studioID
+		}
+		created, err := imp.gh.ImportScene(req)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	case "Markers":
+		var req GHImportMarkerRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		sceneID, ok := imp.idMap.Scenes[firstRef(step.Refs, "scene")]
+		if !ok {
+			return 0, fmt.Errorf("scene %s was not imported", imp.sourceRef(firstRef(step.Refs, "scene")))
+		}
+		req.SceneID = sceneID
+		created, err := imp.gh.ImportMarker(req)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	case "Searches":
+		var req GHCreateSavedSearchRequest
+		if err := json.Unmarshal(step.Request, &req); err != nil {
+			return 0, fmt.Errorf("invalid request: %w", err)
+		}
+		created, err := imp.createSavedSearch(req, step.Refs)
+		if err != nil {
+			return 0, err
+		}
+		return created.ID, nil
+	}
+	return 0, fmt.Errorf("unknown phase %q", step.Phase)
+}
+
+func firstRef(refs map[string][]string, key string) string {
+	if len(refs[key]) == 0 {
+		return ""
+	}
+	return refs[key][0]
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Pruner removes GoonHub entities whose source counterpart no longer exists.
+// Only IDMap entries owned by the configured source are considered, so running
+// it against one source never touches what another source imported.
+//
+// Only entities the importer created are deleted. A GoonHub entity that another
+// mapped source ID still points at (duplicate performers reused by name, scenes
+// mapped on conflict) is always kept, and one the journals don't show the
+// importer creating (reused by name, matched on conflict, or imported before
+// runs were journaled) is kept unless deleteReused is set. Kept entities only
+// lose the orphaned mapping.
+type Pruner struct {
+	source       Source
+	gh           *GoonHubClient
+	idMap        *IDMap
+	force        bool
+	deleteReused bool
+	// created holds the entities journaled as created, as "<phase>:<gh id>".
+	created map[string]bool
+}
+
+// Orphan is an IDMap entry whose source ID is gone from the source.
+type Orphan struct {
+	Kind     string // "marker", "scene" or "actor"
+	SourceID string
+	GHID     uint
+	// Keep is why the GoonHub entity stays and only the mapping is removed, or
+	// "" to delete it.
+	Keep string
+}
+
+func runPrune(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "delete the orphaned GoonHub entities (default: list them only)")
+	yes := fs.Bool("yes", false, "don't ask for confirmation before deleting")
+	force := fs.Bool("force", false, "prune a kind even if the source returned none of it")
+	deleteReused := fs.Bool("delete-reused", false, "also delete entities the importer reused or matched rather than created")
+	_ = fs.Parse(args)
+
+	if *apply && cfg.DryRun {
+		fmt.Println("[Config]  DRY_RUN=true overrides --apply - no changes will be made")
+		*apply = false
+	}
+
+	idMap := mustLoadIDMap(cfg)
+	source, err := OpenSource(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[Config]  GoonHub: %s\n", cfg.GoonHubBaseURL)
+
+	created, err := createdEntities(cfg.RunsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Prune failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	p := &Pruner{source: source, idMap: idMap, force: *force, deleteReused: *deleteReused, created: created}
+	orphans, err := p.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Prune failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	printOrphans(orphans)
+	if len(orphans) == 0 {
+		fmt.Println("\nNothing to prune.")
+		return
+	}
+	if !*apply {
+		fmt.Println("\nNo changes made. Run again with --apply to delete these from GoonHub.")
+		return
+	}
+	deletes := 0
+	for _, o := range orphans {
+		if o.Keep == "" {
+			deletes++
+		}
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete %d GoonHub entities and remove %d mappings?", deletes, len(orphans))) {
+		fmt.Println("Aborted.")
+		return
+	}
+
+	p.gh = mustLoginGoonHub(cfg)
+	stats := p.Delete(orphans)
+	if err := idMap.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save id map: %v\n", err)
+		os.Exit(1)
+	}
+	printStats("Prune", stats)
+	if stats.Errors > 0 {
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// Find lists orphaned markers, scenes and actors, in that order so dependents are
+// deleted before what they point at.
+func (p *Pruner) Find() ([]Orphan, error) {
+	fmt.Printf("\n[Prune]   Fetching current IDs from %s...\n", p.source.Name())
+
+	markers, err := p.source.Markers()
+	if err != nil {
+		return nil, err
+	}
+	scenes, err := p.source.Scenes()
+	if err != nil {
+		return nil, err
+	}
+	performers, err := p.source.Performers()
+	if err != nil {
+		return nil, err
+	}
+
+	markerIDs := make(map[string]bool, len(markers))
+	for _, m := range markers {
+		markerIDs[m.ID] = true
+	}
+	sceneIDs := make(map[string]bool, len(scenes))
+	for _, sc := range scenes {
+		sceneIDs[sc.ID] = true
+	}
+	actorIDs := make(map[string]bool, len(performers))
+	for _, pf := range performers {
+		actorIDs[pf.ID] = true
+	}
+
+	var orphans []Orphan
+	orphans = append(orphans, p.orphans("marker", "Markers", p.idMap.Markers, markerIDs)...)
+	orphans = append(orphans, p.orphans("scene", "Scenes", p.idMap.Scenes, sceneIDs)...)
+	orphans = append(orphans, p.orphans("actor", "Actors", p.idMap.Actors, actorIDs)...)
+	return orphans, nil
+}
+
+func (p *Pruner) orphans(kind, phase string, mapped map[string]uint, present map[string]bool) []Orphan {
+	name := p.source.Name()
+	var out []Orphan
+	owned := 0
+	// GoonHub IDs that a source ID other than an orphan still maps to.
+	inUse := make(map[uint]bool)
+	for id, ghID := range mapped {
+		if !ownsID(name, id) {
+			inUse[ghID] = true
+			continue
+		}
+		owned++
+		if present[id] {
+			inUse[ghID] = true
+		} else {
+			out = append(out, Orphan{Kind: kind, SourceID: id, GHID: ghID})
+		}
+	}
+	for i := range out {
+		o := &out[i]
+		switch {
+		case inUse[o.GHID]:
+			o.Keep = "still mapped from another source ID"
+		case !p.created[fmt.Sprintf("%s:%d", phase, o.GHID)] && !p.deleteReused:
+			o.Keep = "not created by the importer"
+		}
+	}
+
+	// An empty result for a kind we've imported before is far more likely a broken
+	// source (wrong DB, empty API response) than everything having been deleted.
+	if len(present) == 0 && owned > 0 && !p.force {
+		fmt.Printf("[Prune]   WARNING: %s returned no %ss but %d are mapped, skipping %ss (use --force to prune them)\n",
+			name, kind, owned, kind)
+		return nil
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].SourceID < out[j].SourceID })
+	return out
+}
+
+// Delete removes each orphan from GoonHub and drops it from IDMap. Entities that
+// are already gone from GoonHub, or that are kept, are dropped from IDMap only.
+func (p *Pruner) Delete(orphans []Orphan) PhaseStats {
+	stats := PhaseStats{}
+	total := len(orphans)
+	fmt.Printf("\n[Prune]   Pruning %d orphaned entities...\n", total)
+
+	for i, o := range orphans {
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+
+		var mapped map[string]uint
+		var remove func(uint) error
+		switch o.Kind {
+		case "marker":
+			mapped, remove = p.idMap.Markers, p.gh.DeleteMarker
+		case "scene":
+			mapped, remove = p.idMap.Scenes, p.gh.DeleteScene
+		case "actor":
+			mapped, remove = p.idMap.Actors, p.gh.DeleteActor
+		}
+		if o.Keep != "" {
+			fmt.Printf("[Prune]   %s Kept %s gh:%d (%s), removing mapping for source %s\n", idx, o.Kind, o.GHID, o.Keep, o.SourceID)
+			delete(mapped, o.SourceID)
+			stats.Skipped++
+			continue
+		}
+
+		err := remove(o.GHID)
+
+		var notFound *NotFoundError
+		switch {
+		case errors.As(err, &notFound):
+			fmt.Printf("[Prune]   %s %s gh:%d already gone, removing mapping\n", idx, o.Kind, o.GHID)
+			stats.Skipped++
+		case err != nil:
+			fmt.Printf("[Prune]   %s ERROR deleting %s gh:%d: %v\n", idx, o.Kind, o.GHID, err)
+			stats.Errors++
+			continue
+		default:
+			fmt.Printf("[Prune]   %s Deleted %s gh:%d (source %s)\n", idx, o.Kind, o.GHID, o.SourceID)
+			stats.Deleted++
+		}
+		delete(mapped, o.SourceID)
+	}
+	return stats
+}
+
+func printOrphans(orphans []Orphan) {
+	counts := make(map[string]int)
+	for _, o := range orphans {
+		counts[o.Kind]++
+		if o.Keep != "" {
+			fmt.Printf("[Prune]   Orphaned %s: source %s -> gh:%d (kept, %s)\n", o.Kind, o.SourceID, o.GHID, o.Keep)
+			continue
+		}
+		fmt.Printf("[Prune]   Orphaned %s: source %s -> gh:%d\n", o.Kind, o.SourceID, o.GHID)
+	}
+	fmt.Printf("\n[Prune]   %d orphaned entities (markers:%d scenes:%d actors:%d)\n",
+		len(orphans), counts["marker"], counts["scene"], counts["actor"])
+}
+
+// createdEntities returns the GoonHub entities the importer created, as
+// "<phase>:<gh id>", from every journaled run that wasn't a dry run.
+func createdEntities(runsDir string) (map[string]bool, error) {
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	created := make(map[string]bool)
+	for _, id := range runs {
+		entries, err := ReadJournal(runsDir, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 && entries[0].DryRun {
+			continue
+		}
+		for _, e := range entries {
+			if e.Action == "created" {
+				created[fmt.Sprintf("%s:%d", e.Phase, e.GHID)] = true
+			}
+		}
+	}
+	return created, nil
+}
+
+// confirm asks a yes/no question on stdin; anything but "y" or "yes" is a no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Relocator points already-imported GoonHub scenes at their files' current
+// location after a library moved. The import phases skip scenes that are in
+// IDMap, so a changed mapping never reaches them; relocate re-maps every mapped
+// scene's file with the current mappings and updates the GoonHub scenes whose
+// stored_path or storage_path_id differ.
+type Relocator struct {
+	source     Source
+	gh         *GoonHubClient
+	idMap      *IDMap
+	pathMapper *PathMapper
+	files      *FileChecker
+}
+
+// Relocation is a GoonHub scene whose stored path no longer matches the mappings.
+// NewStorageID is 0 when the mapping leaves the storage path to GoonHub.
+type Relocation struct {
+	SourceID     string
+	GHID         uint
+	OldPath      string
+	NewPath      string
+	OldStorageID *uint
+	NewStorageID uint
+}
+
+func runRelocate(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("relocate", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "update the GoonHub scenes (default: list them only)")
+	yes := fs.Bool("yes", false, "don't ask for confirmation before updating")
+	_ = fs.Parse(args)
+
+	if *apply && cfg.DryRun {
+		fmt.Println("[Config]  DRY_RUN=true overrides --apply - no changes will be made")
+		*apply = false
+	}
+	fmt.Printf("[Config]  GoonHub: %s\n", cfg.GoonHubBaseURL)
+
+	mappings, err := LoadMappings(cfg.MappingsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[Config]  Loaded %d path mapping(s)\n", len(mappings))
+	cfg.PathMappings = mappings
+
+	idMap := mustLoadIDMap(cfg)
+	source, err := OpenSource(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+	gh := mustLoginGoonHub(cfg)
+	mustCheckStoragePaths(cfg, gh)
+	pathMapper, err := NewPathMapper(cfg.PathMappings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+
+	r := &Relocator{source: source, gh: gh, idMap: idMap, pathMapper: pathMapper, files: NewFileChecker(cfg)}
+	moves, errs, err := r.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Relocate failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	printRelocations(moves)
+	if len(moves) == 0 {
+		fmt.Println("\nNothing to relocate.")
+		if errs > 0 {
+			releaseIDMap()
+			os.Exit(1)
+		}
+		return
+	}
+	if !*apply {
+		fmt.Println("\nNo changes made. Run again with --apply to update these scenes in GoonHub.")
+		return
+	}
+	if !*yes && !confirm(fmt.Sprintf("Update %d GoonHub scenes?", len(moves))) {
+		fmt.Println("Aborted.")
+		return
+	}
+
+	stats := r.Update(moves)
+	stats.Errors += errs
+	printStats("Relocate", stats)
+	if stats.Errors > 0 {
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// Find compares every mapped scene owned by the source with its GoonHub scene.
+// Scenes that can't be mapped or checked are reported and counted as errors.
+func (r *Relocator) Find() ([]Relocation, int, error) {
+	fmt.Printf("\n[Relocate] Fetching scenes from %s...\n", r.source.Name())
+	scenes, err := r.source.Scenes()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var moves []Relocation
+	errs, checked := 0, 0
+	for _, scene := range scenes {
+		ghID, ok := r.idMap.Scenes[scene.ID]
+		if !ok || len(scene.Files) == 0 {
+			continue
+		}
+		checked++
+		file := scene.Files[0]
+
+		mapped, err := r.pathMapper.MapPath(file.Path)
+		if err != nil {
+			fmt.Printf("[Relocate] WARNING: %v, skipping scene %s\n", err, scene.ID)
+			errs++
+			continue
+		}
+		current, err := r.gh.GetScene(ghID)
+		var notFound *NotFoundError
+		switch {
+		case errors.As(err, &notFound):
+			fmt.Printf("[Relocate] Scene %s: gh:%d is gone from GoonHub, skipping\n", scene.ID, ghID)
+			continue
+		case err != nil:
+			fmt.Printf("[Relocate] ERROR fetching scene gh:%d: %v\n", ghID, err)
+			errs++
+			continue
+		}
+
+		samePath := current.StoredPath == mapped.GoonHubPath
+		sameStorage := mapped.StoragePathID == 0 || (current.StoragePathID != nil && *current.StoragePathID == mapped.StoragePathID)
+		if samePath && sameStorage {
+			continue
+		}
+		if err := r.files.Check(scene.ID, file, mapped.GoonHubPath); err != nil {
+			fmt.Printf("[Relocate] WARNING: %v, skipping scene %s\n", err, scene.ID)
+			errs++
+			continue
+		}
+		moves = append(moves, Relocation{
+			SourceID:     scene.ID,
+			GHID:         ghID,
+			OldPath:      current.StoredPath,
+			NewPath:      mapped.GoonHubPath,
+			OldStorageID: current.StoragePathID,
+			NewStorageID: mapped.StoragePathID,
+		})
+	}
+	r.files.Report()
+
+	sort.Slice(moves, func(i, j int) bool { return moves[i].SourceID < moves[j].SourceID })
+	fmt.Printf("[Relocate] Checked %d mapped scenes\n", checked)
+	return moves, errs, nil
+}
+
+// Update writes the new stored path and storage path to each GoonHub scene.
+func (r *Relocator) Update(moves []Relocation) PhaseStats {
+	stats := PhaseStats{}
+	total := len(moves)
+	fmt.Printf("\n[Relocate] Updating %d GoonHub scenes...\n", total)
+
+	for i, m := range moves {
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+
+		req := GHUpdateSceneRequest{StoredPath: &m.NewPath}
+		if m.NewStorageID > 0 {
+			req.StoragePathID = &m.NewStorageID
+		}
+		if err := r.gh.UpdateScene(m.GHID, req); err != nil {
+			fmt.Printf("[Relocate] %s ERROR updating scene gh:%d: %v\n", idx, m.GHID, err)
+			stats.Errors++
+			continue
+		}
+		fmt.Printf("[Relocate] %s Relocated scene gh:%d to %s\n", idx, m.GHID, m.NewPath)
+		stats.Updated++
+	}
+	return stats
+}
+
+func printRelocations(moves []Relocation) {
+	for _, m := range moves {
+		fmt.Printf("[Relocate] Scene %s -> gh:%d\n", m.SourceID, m.GHID)
+		if m.OldPath != m.NewPath {
+			fmt.Printf("[Relocate]   path:         %s -> %s\n", m.OldPath, m.NewPath)
+		}
+		if m.NewStorageID > 0 && (m.OldStorageID == nil || *m.OldStorageID != m.NewStorageID) {
+			fmt.Printf("[Relocate]   storage path: %s -> %d\n", storageIDString(m.OldStorageID), m.NewStorageID)
+		}
+	}
+	fmt.Printf("\n[Relocate] %d scene(s) to relocate\n", len(moves))
+}
+
+func storageIDString(id *uint) string {
+	if id == nil {
+		return "none"
+	}
+	return fmt.Sprint(*id)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runRetryFailed(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	list := fs.Bool("list", false, "only list the recorded failures")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goonhub-stash-importer retry-failed [--list]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	failures := mustLoadFailures(cfg)
+	if failures.Len() == 0 {
+		fmt.Printf("[Retry]   No failures recorded in %s\n", cfg.FailuresFile)
+		return
+	}
+	fmt.Printf("[Retry]   %d failed entities recorded in %s\n", failures.Len(), cfg.FailuresFile)
+	if *list {
+		printFailures(failures)
+		return
+	}
+
+	imp := mustSetupImporter(cfg)
+	data, err := FetchFailedData(imp.source, failures, imp.parser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+		os.Exit(1)
+	}
+	dropMissing(failures, imp.source.Name(), data)
+
+	// Retried scenes, markers and saved searches refer to tags outside the failure list, so the
+	// tag rules need the full tag list to resolve merges.
+	if imp.tagRules.Len() > 0 {
+		tags, err := imp.source.Tags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Source error: %v\n", err)
+			os.Exit(1)
+		}
+		imp.resolveTags(tags)
+	}
+
+	imp.journal = mustStartJournal(cfg, "retry-failed", imp.source.Name())
+	imp.idMap.RunID = imp.journal.ID
+	defer imp.journal.Close()
+	if !cfg.DryRun {
+		imp.failures = failures
+	}
+
+	allStats := imp.RunPhases(data)
+	imp.journal.Finished(allStats)
+
+	printSummary("Retry", allStats)
+	if !cfg.DryRun {
+		printReindexHint(cfg, allStats)
+		fmt.Printf("\n%d failed entities left in %s\n", failures.Len(), cfg.FailuresFile)
+	}
+	printJournalHint(imp.journal, cfg.DryRun)
+
+	if totalErrors(allStats) > 0 {
+		imp.journal.Close()
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// dropMissing removes failures the source no longer has, e.g. scenes deleted in
+// Stash since they failed; there is nothing left to retry for them.
+func dropMissing(failures *FailureList, source string, data *SourceData) {
+	found := map[string]map[string]bool{
+		"Tags":    make(map[string]bool),
+		"Studios": make(map[string]bool),
+		"Actors":  make(map[string]bool),
+		"Scenes":  make(map[string]bool),
+		"Markers": make(map[string]bool),
+
+		"Searches": make(map[string]bool),
+	}
+	for _, t := range data.Tags {
+		found["Tags"][t.ID] = true
+	}
+	for _, s := range data.Studios {
+		found["Studios"][s.ID] = true
+	}
+	for _, p := range data.Performers {
+		found["Actors"][p.ID] = true
+	}
+	for _, s := range data.Scenes {
+		found["Scenes"][s.ID] = true
+	}
+	for _, m := range data.Markers {
+		found["Markers"][m.ID] = true
+	}
+	for _, f := range data.SavedFilters {
+		found["Searches"][f.ID] = true
+	}
+
+	for phase, ids := range found {
+		for _, id := range failures.IDs(phase, source) {
+			if !ids[id] {
+				fmt.Printf("[Retry]   %s %s no longer exists in %s, dropping it\n", singular(phase), id, source)
+				failures.Resolved(phase, id)
+			}
+		}
+	}
+}
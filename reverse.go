@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ReverseSync writes GoonHub edits back to Stash for entities paired in IDMap.
+// Only fields both sides share are compared (see EntityPair).
+type ReverseSync struct {
+	stash     *StashClient
+	collector *pairCollector
+}
+
+// EntityDiff is one paired entity whose GoonHub fields differ from Stash.
+type EntityDiff struct {
+	Kind    string // "tag", "performer" or "scene"
+	StashID string
+	GHID    uint
+	Label   string
+	Changes []FieldChange
+}
+
+func NewReverseSync(stash *StashClient, gh *GoonHubClient, idMap *IDMap, rules importRules, since time.Time) *ReverseSync {
+	return &ReverseSync{
+		stash:     stash,
+		collector: newPairCollector(stash, gh, idMap, rules, since, "Reverse"),
+	}
+}
+
+func runReverse(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("reverse", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "write the changes to Stash (default: print the diff only)")
+	sinceStr := fs.String("since", "", "only consider GoonHub scenes/actors updated after this date (YYYY-MM-DD or RFC 3339)")
+	_ = fs.Parse(args)
+
+	if cfg.StashBaseURL == "" || cfg.StashAPIKey == "" {
+		fmt.Fprintln(os.Stderr, "reverse requires STASH_BASE_URL and STASH_API_KEY (the SQLite reader is read-only)")
+		os.Exit(1)
+	}
+	var since time.Time
+	if *sinceStr != "" {
+		t, err := parseSince(*sinceStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --since: %v\n", err)
+			os.Exit(2)
+		}
+		since = t
+	}
+	if *apply && cfg.DryRun {
+		fmt.Println("[Config]  DRY_RUN=true overrides --apply - no changes will be made")
+		*apply = false
+	}
+
+	rules := mustLoadImportRules(cfg)
+	idMap := mustLoadIDMap(cfg)
+	fmt.Printf("[Config]  Stash:   %s\n", cfg.StashBaseURL)
+	fmt.Printf("[Config]  GoonHub: %s\n", cfg.GoonHubBaseURL)
+	ghClient := mustLoginGoonHub(cfg)
+
+	rs := NewReverseSync(NewStashClient(cfg.StashBaseURL, cfg.StashAPIKey), ghClient, idMap, rules, since)
+	diffs, err := rs.Diff()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reverse diff failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	printDiffs("Reverse", diffs)
+	if len(diffs) == 0 {
+		fmt.Println("\nStash is already up to date.")
+		return
+	}
+	if !*apply {
+		fmt.Println("\nNo changes made. Run again with --apply to write these changes to Stash.")
+		return
+	}
+
+	stats := rs.Apply(diffs)
+	printStats("Reverse", stats)
+	if stats.Errors > 0 {
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// Diff compares every paired tag, performer and scene and returns the ones that differ.
+func (r *ReverseSync) Diff() ([]EntityDiff, error) {
+	pairs, err := r.collector.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []EntityDiff
+	for _, p := range pairs {
+		changes := diffFields(p.Stash, p.GH)
+		if len(changes) == 0 {
+			continue
+		}
+		diffs = append(diffs, EntityDiff{
+			Kind:    p.Kind,
+			StashID: p.StashID,
+			GHID:    p.GHID,
+			Label:   p.Label,
+			Changes: changes,
+		})
+	}
+	return diffs, nil
+}
+
+// Apply writes each diff to Stash with the matching update mutation.
+func (r *ReverseSync) Apply(diffs []EntityDiff) PhaseStats {
+	stats := PhaseStats{}
+	total := len(diffs)
+	fmt.Printf("\n[Reverse] Writing %d entities to Stash...\n", total)
+
+	for i, d := range diffs {
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		fields := make(entityFields, len(d.Changes))
+		for _, c := range d.Changes {
+			fields[c.Field] = c.To
+		}
+
+		if err := updateStash(r.stash, d.Kind, d.StashID, fields); err != nil {
+			fmt.Printf("[Reverse] %s ERROR updating %s %q: %v\n", idx, d.Kind, d.Label, err)
+			stats.Errors++
+			continue
+		}
+		fmt.Printf("[Reverse] %s Updated %s %q (%d fields)\n", idx, d.Kind, d.Label, len(d.Changes))
+		stats.Updated++
+	}
+	return stats
+}
+
+// updateStash writes Stash-terms field values with the update mutation for kind.
+func updateStash(stash *StashClient, kind, stashID string, fields entityFields) error {
+	input := stashUpdateInput(stashID, fields)
+	switch kind {
+	case "tag":
+		return stash.UpdateTag(input)
+	case "performer":
+		return stash.UpdatePerformer(input)
+	case "scene":
+		return stash.UpdateScene(input)
+	}
+	return fmt.Errorf("unknown entity kind %q", kind)
+}
+
+func printDiffs(prefix string, diffs []EntityDiff) {
+	counts := make(map[string]int)
+	tag := fmt.Sprintf("[%s]", prefix)
+	for _, d := range diffs {
+		counts[d.Kind]++
+		fmt.Printf("\n%-9s %s %q (stash:%s <-> gh:%d)\n", tag, d.Kind, d.Label, d.StashID, d.GHID)
+		for _, c := range d.Changes {
+			fmt.Printf("%-9s     %s: %q -> %q\n", tag, c.Field, c.From, c.To)
+		}
+	}
+	fmt.Printf("\n%-9s %d entities differ (tags:%d performers:%d scenes:%d)\n",
+		tag, len(diffs), counts["tag"], counts["performer"], counts["scene"])
+}
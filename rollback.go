@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// rollbackOrder deletes dependents before what they point at.
+var rollbackOrder = []string{"Searches", "Markers", "Scenes", "Actors", "Studios", "Tags"}
+
+// Rollback undoes one journaled run: associations it changed on pre-existing
+// entities are restored, mappings it added to existing entities are dropped, and
+// everything it created is deleted.
+type Rollback struct {
+	gh      *GoonHubClient
+	idMap   *IDMap
+	entries []JournalEntry
+}
+
+func runRollback(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "perform the rollback (default: list what would be undone)")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goonhub-stash-importer rollback [--apply] [--yes] <run-id>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	runID := fs.Arg(0)
+	// Allow flags after the run ID too.
+	_ = fs.Parse(fs.Args()[1:])
+
+	if *apply && cfg.DryRun {
+		fmt.Println("[Config]  DRY_RUN=true overrides --apply - no changes will be made")
+		*apply = false
+	}
+
+	entries, err := ReadJournal(cfg.RunsDir, runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Rollback error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, e := range entries {
+		if e.Action == "started" && e.DryRun {
+			fmt.Printf("Run %s was a dry run; there is nothing to roll back.\n", runID)
+			return
+		}
+		if e.Action == "rolled_back" {
+			fmt.Fprintf(os.Stderr, "Run %s was already rolled back at %s\n", runID, e.Time.Local().Format("2006-01-02 15:04:05"))
+			os.Exit(1)
+		}
+	}
+
+	rb := &Rollback{idMap: mustLoadIDMap(cfg), entries: entries}
+	restores, mappings, deletes := rb.Steps()
+	fmt.Printf("[Rollback] Run %s: %d associations to restore, %d mappings to drop, %d entities to delete\n",
+		runID, len(restores), len(mappings), len(deletes))
+	for _, e := range deletes {
+		fmt.Printf("[Rollback]   delete %s gh:%d (%s)\n", singular(e.Phase), e.GHID, e.SourceID)
+	}
+
+	if len(restores)+len(mappings)+len(deletes) == 0 {
+		fmt.Println("\nNothing to roll back.")
+		return
+	}
+	if !*apply {
+		fmt.Println("\nNo changes made. Run again with --apply to roll back.")
+		return
+	}
+	if !*yes && !confirm(fmt.Sprintf("Roll back run %s?", runID)) {
+		fmt.Println("Aborted.")
+		return
+	}
+
+	journal, err := OpenRunJournal(cfg.RunsDir, runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Rollback error: %v\n", err)
+		os.Exit(1)
+	}
+	defer journal.Close()
+
+	rb.gh = mustLoginGoonHub(cfg)
+	stats := rb.Apply(restores, mappings, deletes)
+	if err := rb.idMap.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save id map: %v\n", err)
+		os.Exit(1)
+	}
+	printStats("Rollback", stats)
+	if stats.Errors > 0 {
+		fmt.Println("Some steps failed; the run is not marked as rolled back, so it can be retried.")
+		releaseIDMap()
+		os.Exit(1)
+	}
+	journal.RolledBack()
+}
+
+// Steps splits the journal into associations to restore (newest first), mappings
+// to drop and created entities to delete in rollbackOrder, newest first.
+func (rb *Rollback) Steps() (restores, mappings, deletes []JournalEntry) {
+	created := make(map[string]bool)
+	for _, e := range rb.entries {
+		if e.Action == "created" {
+			created[fmt.Sprintf("%s:%d", e.Phase, e.GHID)] = true
+		}
+	}
+
+	for i := len(rb.entries) - 1; i >= 0; i-- {
+		e := rb.entries[i]
+		switch e.Action {
+		case "associated":
+			// Entities created by the run are deleted anyway.
+			if !created[fmt.Sprintf("%s:%d", e.Phase, e.GHID)] {
+				restores = append(restores, e)
+			}
+		case "mapped":
+			mappings = append(mappings, e)
+		}
+	}
+
+	for _, phase := range rollbackOrder {
+		for i := len(rb.entries) - 1; i >= 0; i-- {
+			if e := rb.entries[i]; e.Action == "created" && e.Phase == phase {
+				deletes = append(deletes, e)
+			}
+		}
+	}
+	return restores, mappings, deletes
+}
+
+func (rb *Rollback) Apply(restores, mappings, deletes []JournalEntry) PhaseStats {
+	stats := PhaseStats{}
+
+	for _, e := range restores {
+		err := rb.restore(e)
+		if errors.Is(err, errNotRestorable) {
+			fmt.Printf("[Rollback] Left %s of %s gh:%d as is (%v)\n", e.Field, singular(e.Phase), e.GHID, err)
+			stats.Skipped++
+			continue
+		}
+		if err != nil {
+			fmt.Printf("[Rollback] ERROR restoring %s of %s gh:%d: %v\n", e.Field, singular(e.Phase), e.GHID, err)
+			stats.Errors++
+			continue
+		}
+		fmt.Printf("[Rollback] Restored %s of %s gh:%d\n", e.Field, singular(e.Phase), e.GHID)
+		stats.Updated++
+	}
+
+	for _, e := range mappings {
+		rb.unmap(e)
+	}
+
+	total := len(deletes)
+	for i, e := range deletes {
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		err := rb.delete(e)
+
+		var notFound *NotFoundError
+		switch {
+		case errors.As(err, &notFound):
+			fmt.Printf("[Rollback] %s %s gh:%d already gone\n", idx, singular(e.Phase), e.GHID)
+			stats.Skipped++
+		case err != nil:
+			fmt.Printf("[Rollback] %s ERROR deleting %s gh:%d: %v\n", idx, singular(e.Phase), e.GHID, err)
+			stats.Errors++
+			continue
+		default:
+			fmt.Printf("[Rollback] %s Deleted %s gh:%d\n", idx, singular(e.Phase), e.GHID)
+			stats.Deleted++
+		}
+		rb.unmap(e)
+	}
+	return stats
+}
+
+// errNotRestorable marks associations the journal doesn't hold enough to undo.
+// They're reported and left as they are; the rest of the rollback still runs.
+var errNotRestorable = errors.New("not restorable")
+
+func (rb *Rollback) restore(e JournalEntry) error {
+	if e.Phase == "Studios" && e.Field == "parent_id" {
+		return rb.gh.UpdateStudio(e.GHID, GHUpdateStudioRequest{ParentID: e.Previous})
+	}
+
+	var set func(uint, []uint) error
+	switch {
+	case e.Phase == "Scenes" && e.Field == "tags":
+		set = rb.gh.SetSceneTags
+	case e.Phase == "Scenes" && e.Field == "actors":
+		set = rb.gh.SetSceneActors
+	case e.Phase == "Markers" && e.Field == "tags":
+		set = rb.gh.SetMarkerTags
+	default:
+		return fmt.Errorf("%w: don't know how to restore %s %s", errNotRestorable, e.Phase, e.Field)
+	}
+	if e.PreviousIDs == nil {
+		return fmt.Errorf("%w: no previous %s were journaled", errNotRestorable, e.Field)
+	}
+	return set(e.GHID, *e.PreviousIDs)
+}
+
+func (rb *Rollback) delete(e JournalEntry) error {
+	switch e.Phase {
+	case "Markers":
+		return rb.gh.DeleteMarker(e.GHID)
+	case "Scenes":
+		return rb.gh.DeleteScene(e.GHID)
+	case "Actors":
+		return rb.gh.DeleteActor(e.GHID)
+	case "Studios":
+		return rb.gh.DeleteStudio(e.GHID)
+	case "Tags":
+		return rb.gh.DeleteTag(e.GHID)
+	case "Searches":
+		return rb.gh.DeleteSavedSearch(e.GHID)
+	}
+	return fmt.Errorf("unknown phase %q", e.Phase)
+}
+
+// unmap drops the ID map entry the journal entry added, unless it has since been
+// pointed elsewhere.
+func (rb *Rollback) unmap(e JournalEntry) {
+	ids := rb.idMap.forPhase(e.Phase)
+	if ids != nil && ids[e.SourceID] == e.GHID {
+		delete(ids, e.SourceID)
+	}
+}
+
+func singular(phase string) string {
+	switch phase {
+	case "Tags":
+		return "tag"
+	case "Studios":
+		return "studio"
+	case "Actors":
+		return "actor"
+	case "Scenes":
+		return "scene"
+	case "Markers":
+		return "marker"
+	case "Searches":
+		return "saved search"
+	}
+	return phase
+}
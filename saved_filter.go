@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StashSavedFilterReader is implemented by readers that can evaluate Stash saved
+// filters. Only the GraphQL API can: the SQLite reader has no query engine.
+type StashSavedFilterReader interface {
+	FetchSavedFilters(mode string) ([]StashSavedFilter, error)
+	FetchScenesMatching(filter, sceneFilter map[string]any) ([]StashScene, error)
+}
+
+// SavedFilterScenes implements SavedFilterSource: it looks up a scene saved
+// filter by ID or name and returns the scenes it matches.
+func (s *StashSource) SavedFilterScenes(nameOrID string) ([]SourceScene, error) {
+	r, ok := s.reader.(StashSavedFilterReader)
+	if !ok {
+		return nil, fmt.Errorf("saved filters need the Stash GraphQL API (unset STASH_DB_PATH)")
+	}
+	filters, err := r.FetchSavedFilters("SCENES")
+	if err != nil {
+		return nil, err
+	}
+	f, err := findSavedFilter(filters, nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("[Source]  Using saved filter %q (id %s)\n", f.Name, f.ID)
+
+	scenes, err := r.FetchScenesMatching(findFilterFromSaved(f.FindFilter), sceneFilterFromSaved(f.ObjectFilter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scenes for saved filter %q: %w", f.Name, err)
+	}
+	return convertStashScenes(scenes), nil
+}
+
+// findSavedFilter picks a saved filter by ID, or else by case-insensitive name.
+func findSavedFilter(filters []StashSavedFilter, nameOrID string) (*StashSavedFilter, error) {
+	for i := range filters {
+		if filters[i].ID == nameOrID {
+			return &filters[i], nil
+		}
+	}
+	var match *StashSavedFilter
+	for i := range filters {
+		if strings.EqualFold(filters[i].Name, nameOrID) {
+			if match != nil {
+				return nil, fmt.Errorf("several saved filters are named %q; use its ID (%s or %s)", nameOrID, match.ID, filters[i].ID)
+			}
+			match = &filters[i]
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no scene saved filter with ID or name %q", nameOrID)
+	}
+	return match, nil
+}
+
+// findFilterFromSaved keeps the saved query and sort but always fetches every
+// match rather than the page the filter was saved on.
+func findFilterFromSaved(f *StashSavedFindFilter) map[string]any {
+	out := map[string]any{"per_page": -1}
+	if f == nil {
+		return out
+	}
+	if f.Q != nil && *f.Q != "" {
+		out["q"] = *f.Q
+	}
+	if f.Sort != nil {
+		out["sort"] = *f.Sort
+	}
+	if f.Direction != nil {
+		out["direction"] = *f.Direction
+	}
+	return out
+}
+
+// sceneFilterFromSaved converts a saved object filter from the Stash UI's
+// criterion format to a SceneFilterType. The UI stores labelled items
+// ({"items": [{"id", "label"}], "excluded": [...], "depth": n}), ranges as
+// {"value": a, "value2": b} and some values as display strings; the API wants
+// plain IDs, flat ranges and enums.
+func sceneFilterFromSaved(obj map[string]any) map[string]any {
+	out := make(map[string]any, len(obj))
+	for key, raw := range obj {
+		c, ok := raw.(map[string]any)
+		if !ok {
+			out[key] = raw
+			continue
+		}
+
+		switch key {
+		case "AND", "OR", "NOT":
+			out[key] = sceneFilterFromSaved(c)
+			continue
+		case "organized", "interactive", "performer_favorite":
+			// Boolean filters are saved as {"value": "true"}.
+			out[key] = fmt.Sprint(c["value"]) == "true"
+			continue
+		}
+
+		crit := make(map[string]any, len(c))
+		for k, v := range c {
+			crit[k] = v
+		}
+		switch v := c["value"].(type) {
+		case map[string]any:
+			delete(crit, "value")
+			if items, ok := v["items"]; ok {
+				crit["value"] = labelledIDs(items)
+				if excluded, ok := v["excluded"]; ok {
+					crit["excludes"] = labelledIDs(excluded)
+				}
+				if depth, ok := v["depth"]; ok {
+					crit["depth"] = depth
+				}
+			} else {
+				for k, vv := range v {
+					crit[k] = vv
+				}
+			}
+		case []any:
+			crit["value"] = labelledIDs(v)
+		case string:
+			if key == "resolution" {
+				crit["value"] = resolutionEnum(v)
+			}
+		}
+		out[key] = crit
+	}
+	return out
+}
+
+// labelledIDs turns [{"id": "1", "label": "..."}] into ["1"]; plain values pass through.
+func labelledIDs(v any) []any {
+	list, _ := v.([]any)
+	out := make([]any, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, m["id"])
+		} else {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// resolutionEnum maps the UI's resolution labels to ResolutionEnum values.
+func resolutionEnum(label string) string {
+	switch strings.ToLower(label) {
+	case "144p":
+		return "VERY_LOW"
+	case "240p":
+		return "LOW"
+	case "360p":
+		return "R360P"
+	case "480p":
+		return "STANDARD"
+	case "540p":
+		return "WEB_HD"
+	case "720p":
+		return "STANDARD_HD"
+	case "1080p":
+		return "FULL_HD"
+	case "1440p":
+		return "QUAD_HD"
+	case "1920p":
+		return "VR_HD"
+	case "4k":
+		return "FOUR_K"
+	case "5k":
+		return "FIVE_K"
+	case "6k":
+		return "SIX_K"
+	case "7k":
+		return "SEVEN_K"
+	case "8k":
+		return "EIGHT_K"
+	case "8k+":
+		return "HUGE"
+	}
+	return label
+}
+
+// SavedFilters implements SavedFilterSource. The SQLite reader has no saved
+// filter support, so it yields none.
+func (s *StashSource) SavedFilters() ([]SourceSavedFilter, error) {
+	r, ok := s.reader.(StashSavedFilterReader)
+	if !ok {
+		fmt.Println("[Source]  Saved filters need the Stash GraphQL API; not migrating them")
+		return nil, nil
+	}
+	filters, err := r.FetchSavedFilters("SCENES")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SourceSavedFilter, 0, len(filters))
+	for _, f := range filters {
+		sf := SourceSavedFilter{ID: f.ID, Name: f.Name, Criteria: f.ObjectFilter}
+		if f.FindFilter != nil && f.FindFilter.Q != nil {
+			sf.Query = *f.FindFilter.Q
+		}
+		out = append(out, sf)
+	}
+	return out, nil
+}
+
+// translateSavedFilter converts a Stash saved filter to a GoonHub saved search.
+// Tags, performers and studios go into refs as source IDs, to be mapped to
+// GoonHub IDs when the search is created (see createSavedSearch). Criteria with
+// no GoonHub equivalent are returned in untranslated.
+func translateSavedFilter(f SourceSavedFilter) (req GHCreateSavedSearchRequest, refs map[string][]string, untranslated []string) {
+	req.Name = f.Name
+	req.Filters.Query = f.Query
+	refs = make(map[string][]string)
+
+	keys := make([]string, 0, len(f.Criteria))
+	for k := range f.Criteria {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		c, _ := f.Criteria[key].(map[string]any)
+		modifier, _ := c["modifier"].(string)
+		items, excluded, depth := criterionItems(c["value"])
+
+		switch key {
+		case "tags":
+			switch modifier {
+			case "INCLUDES":
+				refs["tags"], req.Filters.TagMatch = items, "any"
+			case "INCLUDES_ALL":
+				refs["tags"], req.Filters.TagMatch = items, "all"
+			case "EXCLUDES":
+				excluded = append(excluded, items...)
+			default:
+				untranslated = append(untranslated, "tags "+modifier)
+				continue
+			}
+			refs["exclude_tags"] = excluded
+			if depth != 0 {
+				untranslated = append(untranslated, "tags (sub-tags)")
+			}
+		case "performers":
+			switch modifier {
+			case "INCLUDES":
+				refs["actors"], req.Filters.ActorMatch = items, "any"
+			case "INCLUDES_ALL":
+				refs["actors"], req.Filters.ActorMatch = items, "all"
+			default:
+				untranslated = append(untranslated, "performers "+modifier)
+				continue
+			}
+			if len(excluded) > 0 {
+				untranslated = append(untranslated, "performers (excluded)")
+			}
+		case "studios":
+			if modifier != "INCLUDES" {
+				untranslated = append(untranslated, "studios "+modifier)
+				continue
+			}
+			refs["studios"] = items
+			if len(excluded) > 0 {
+				untranslated = append(untranslated, "studios (excluded)")
+			}
+			if depth != 0 {
+				untranslated = append(untranslated, "studios (sub-studios)")
+			}
+		case "rating100":
+			lo, hi, ok := criterionRange(c)
+			if !ok {
+				untranslated = append(untranslated, "rating "+modifier)
+				continue
+			}
+			if n, ok := lo.(float64); ok {
+				r := n / 20
+				req.Filters.MinRating = &r
+			}
+			if n, ok := hi.(float64); ok {
+				r := n / 20
+				req.Filters.MaxRating = &r
+			}
+		case "date":
+			lo, hi, ok := criterionRange(c)
+			if !ok {
+				untranslated = append(untranslated, "date "+modifier)
+				continue
+			}
+			req.Filters.MinDate, _ = lo.(string)
+			req.Filters.MaxDate, _ = hi.(string)
+		case "resolution":
+			label, _ := c["value"].(string)
+			h := resolutionHeight(label)
+			switch {
+			case h == 0:
+				untranslated = append(untranslated, "resolution "+label)
+			case modifier == "EQUALS":
+				req.Filters.MinHeight, req.Filters.MaxHeight = h, h
+			case modifier == "GREATER_THAN":
+				req.Filters.MinHeight = h + 1
+			case modifier == "LESS_THAN":
+				req.Filters.MaxHeight = h - 1
+			default:
+				untranslated = append(untranslated, "resolution "+modifier)
+			}
+		default:
+			untranslated = append(untranslated, key)
+		}
+	}
+	return req, refs, untranslated
+}
+
+// criterionItems reads a multi-value criterion: either the UI's
+// {"items": [...], "excluded": [...], "depth": n} or a plain list of labelled IDs.
+func criterionItems(v any) (items, excluded []string, depth int) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return idStrings(labelledIDs(v)), nil, 0
+	}
+	if d, ok := m["depth"].(float64); ok {
+		depth = int(d)
+	}
+	return idStrings(labelledIDs(m["items"])), idStrings(labelledIDs(m["excluded"])), depth
+}
+
+func idStrings(ids []any) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, fmt.Sprint(id))
+	}
+	return out
+}
+
+// criterionRange turns a range criterion ({"value": {"value": a, "value2": b}})
+// into inclusive bounds; nil means unbounded. Strict comparisons are treated as
+// inclusive, which is as close as a min/max search gets.
+func criterionRange(c map[string]any) (lo, hi any, ok bool) {
+	v, _ := c["value"].(map[string]any)
+	if v == nil {
+		return nil, nil, false
+	}
+	switch c["modifier"] {
+	case "EQUALS":
+		return v["value"], v["value"], true
+	case "GREATER_THAN":
+		return v["value"], nil, true
+	case "LESS_THAN":
+		return nil, v["value"], true
+	case "BETWEEN":
+		return v["value"], v["value2"], true
+	}
+	return nil, nil, false
+}
+
+// resolutionHeight maps the UI's resolution labels to pixel heights, or 0.
+func resolutionHeight(label string) int {
+	switch strings.ToLower(label) {
+	case "144p":
+		return 144
+	case "240p":
+		return 240
+	case "360p":
+		return 360
+	case "480p":
+		return 480
+	case "540p":
+		return 540
+	case "720p":
+		return 720
+	case "1080p":
+		return 1080
+	case "1440p":
+		return 1440
+	case "1920p":
+		return 1920
+	case "4k":
+		return 2160
+	case "5k":
+		return 2880
+	case "6k":
+		return 3384
+	case "7k":
+		return 4032
+	case "8k":
+		return 4320
+	}
+	return 0
+}
+
+// matchesEverything reports whether a translated search has no criteria left, in
+// which case creating it would be misleading.
+func matchesEverything(f GHSavedSearchFilters, refs map[string][]string) bool {
+	for _, ids := range refs {
+		if len(ids) > 0 {
+			return false
+		}
+	}
+	return f.Query == "" && f.MinRating == nil && f.MaxRating == nil &&
+		f.MinDate == "" && f.MaxDate == "" && f.MinHeight == 0 && f.MaxHeight == 0
+}
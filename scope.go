@@ -0,0 +1,267 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImportScope narrows an import to some phases and a subset of scenes.
+//
+// SavedFilter names a Stash saved filter that selects the scenes at fetch time;
+// the other filters then narrow its result further.
+//
+// A scene is kept when it matches every filter given; within one filter any value
+// matches (e.g. --tag a,b keeps scenes tagged a or b). Studio, tag and performer
+// values are source IDs or names. When scenes are filtered, only the tags,
+// studios (with their parents) and performers referenced by the kept scenes and
+// their markers are imported alongside them.
+type ImportScope struct {
+	Phases      []string `json:"phases,omitempty"`
+	SavedFilter string   `json:"saved_filter,omitempty"`
+	Studios     []string `json:"studios,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Performers  []string `json:"performers,omitempty"`
+	PathPrefix  string   `json:"path_prefix,omitempty"`
+	DateFrom    string   `json:"date_from,omitempty"`
+	DateTo      string   `json:"date_to,omitempty"`
+	SceneIDs    []string `json:"scene_ids,omitempty"`
+}
+
+// addScopeFlags registers the phase and filter flags on fs.
+func addScopeFlags(fs *flag.FlagSet) *ImportScope {
+	s := &ImportScope{}
+	fs.Func("phases", "comma-separated phases to run: tags, studios, actors, scenes, markers, searches (default: all)", func(v string) error {
+		for _, p := range splitList(v, ",") {
+			phase := phaseName(p)
+			if phase == "" {
+				return fmt.Errorf("unknown phase %q", p)
+			}
+			s.Phases = append(s.Phases, phase)
+		}
+		return nil
+	})
+	fs.StringVar(&s.SavedFilter, "saved-filter", "", "only scenes matched by this Stash saved filter (ID or name)")
+	listFlag(fs, &s.Studios, "studio", "only scenes from these studios (IDs or names, comma-separated)")
+	listFlag(fs, &s.Tags, "tag", "only scenes with any of these tags (IDs or names)")
+	listFlag(fs, &s.Performers, "performer", "only scenes with any of these performers (IDs or names)")
+	listFlag(fs, &s.SceneIDs, "ids", "only these scene IDs")
+	fs.StringVar(&s.PathPrefix, "path-prefix", "", "only scenes with a file under this source path")
+	fs.Func("date-from", "only scenes dated on or after `YYYY-MM-DD`", dateFlag(&s.DateFrom))
+	fs.Func("date-to", "only scenes dated on or before `YYYY-MM-DD`", dateFlag(&s.DateTo))
+	return s
+}
+
+func listFlag(fs *flag.FlagSet, dst *[]string, name, usage string) {
+	fs.Func(name, usage, func(v string) error {
+		*dst = append(*dst, splitList(v, ",")...)
+		return nil
+	})
+}
+
+func dateFlag(dst *string) func(string) error {
+	return func(v string) error {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return fmt.Errorf("expected YYYY-MM-DD, got %q", v)
+		}
+		*dst = v
+		return nil
+	}
+}
+
+// phaseName maps a phase as typed on the command line to its internal name.
+func phaseName(p string) string {
+	switch strings.ToLower(p) {
+	case "tags":
+		return "Tags"
+	case "studios":
+		return "Studios"
+	case "actors", "performers":
+		return "Actors"
+	case "scenes":
+		return "Scenes"
+	case "markers":
+		return "Markers"
+	case "searches", "saved-searches":
+		return "Searches"
+	}
+	return ""
+}
+
+// RunsPhase reports whether phase is selected. A nil scope runs everything.
+func (s *ImportScope) RunsPhase(phase string) bool {
+	if s == nil || len(s.Phases) == 0 {
+		return true
+	}
+	for _, p := range s.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// FiltersScenes reports whether any scene filter is set.
+func (s *ImportScope) FiltersScenes() bool {
+	return s != nil && (s.SavedFilter != "" || len(s.Studios) > 0 || len(s.Tags) > 0 || len(s.Performers) > 0 ||
+		len(s.SceneIDs) > 0 || s.PathPrefix != "" || s.DateFrom != "" || s.DateTo != "")
+}
+
+func (s *ImportScope) String() string {
+	var parts []string
+	if len(s.Phases) > 0 {
+		parts = append(parts, "phases="+strings.Join(s.Phases, ","))
+	}
+	if s.SavedFilter != "" {
+		parts = append(parts, fmt.Sprintf("saved-filter=%q", s.SavedFilter))
+	}
+	for _, f := range []struct {
+		name   string
+		values []string
+	}{{"studio", s.Studios}, {"tag", s.Tags}, {"performer", s.Performers}, {"ids", s.SceneIDs}} {
+		if len(f.values) > 0 {
+			parts = append(parts, f.name+"="+strings.Join(f.values, ","))
+		}
+	}
+	if s.PathPrefix != "" {
+		parts = append(parts, "path-prefix="+s.PathPrefix)
+	}
+	if s.DateFrom != "" {
+		parts = append(parts, "date-from="+s.DateFrom)
+	}
+	if s.DateTo != "" {
+		parts = append(parts, "date-to="+s.DateTo)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Apply filters data's scenes and narrows the other entities to their dependencies.
+func (s *ImportScope) Apply(data *SourceData) *SourceData {
+	if !s.FiltersScenes() {
+		return data
+	}
+
+	studios := resolveRefs(s.Studios, data.Studios, func(st SourceStudio) (string, string) { return st.ID, st.Name })
+	tags := resolveRefs(s.Tags, data.Tags, func(t SourceTag) (string, string) { return t.ID, t.Name })
+	performers := resolveRefs(s.Performers, data.Performers, func(p SourcePerformer) (string, string) { return p.ID, p.Name })
+	sceneIDs := make(map[string]bool, len(s.SceneIDs))
+	for _, id := range s.SceneIDs {
+		sceneIDs[id] = true
+	}
+
+	out := &SourceData{}
+	for _, sc := range data.Scenes {
+		switch {
+		case len(s.SceneIDs) > 0 && !sceneIDs[sc.ID]:
+		case studios != nil && !studios[sc.StudioID]:
+		case tags != nil && !anyOf(sc.TagIDs, tags):
+		case performers != nil && !anyOf(sc.PerformerIDs, performers):
+		case s.PathPrefix != "" && !hasFileUnder(sc, s.PathPrefix):
+		case (s.DateFrom != "" || s.DateTo != "") && !inDateRange(sc.Date, s.DateFrom, s.DateTo):
+		default:
+			out.Scenes = append(out.Scenes, sc)
+		}
+	}
+	out.Markers = markersForScenes(data.Markers, out.Scenes)
+
+	// Pull in what the kept scenes and markers refer to.
+	needTags := make(map[string]bool)
+	needStudios := make(map[string]bool)
+	needPerformers := make(map[string]bool)
+	for _, sc := range out.Scenes {
+		for _, id := range sc.TagIDs {
+			needTags[id] = true
+		}
+		for _, id := range sc.PerformerIDs {
+			needPerformers[id] = true
+		}
+		if sc.StudioID != "" {
+			needStudios[sc.StudioID] = true
+		}
+	}
+	for _, m := range out.Markers {
+		for _, id := range markerTagIDs(m) {
+			needTags[id] = true
+		}
+	}
+	parents := make(map[string]string, len(data.Studios))
+	for _, st := range data.Studios {
+		parents[st.ID] = st.ParentID
+	}
+	for id := range needStudios {
+		for p := parents[id]; p != "" && !needStudios[p]; p = parents[p] {
+			needStudios[p] = true
+		}
+	}
+
+	for _, t := range data.Tags {
+		if needTags[t.ID] {
+			out.Tags = append(out.Tags, t)
+		}
+	}
+	for _, st := range data.Studios {
+		if needStudios[st.ID] {
+			out.Studios = append(out.Studios, st)
+		}
+	}
+	for _, p := range data.Performers {
+		if needPerformers[p.ID] {
+			out.Performers = append(out.Performers, p)
+		}
+	}
+
+	fmt.Printf("[Scope]   %s: %d of %d scenes, with %d tags, %d studios, %d performers and %d markers\n",
+		s, len(out.Scenes), len(data.Scenes), len(out.Tags), len(out.Studios), len(out.Performers), len(out.Markers))
+	return out
+}
+
+// resolveRefs turns filter values into a set of source IDs, matching each value
+// against IDs first and then names (case-insensitively). Returns nil when no values
+// are given, meaning "don't filter".
+func resolveRefs[T any](values []string, items []T, key func(T) (id, name string)) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, v := range values {
+		for _, item := range items {
+			id, name := key(item)
+			if id == v || strings.EqualFold(name, v) {
+				set[id] = true
+			}
+		}
+	}
+	return set
+}
+
+func anyOf(ids []string, set map[string]bool) bool {
+	for _, id := range ids {
+		if set[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFileUnder reports whether any of the scene's files is under the directory
+// prefix. Paths are normalised like path mappings, so "/data" doesn't match
+// "/database" and Windows or UNC spellings of the same path match.
+func hasFileUnder(sc SourceScene, prefix string) bool {
+	prefix = normalizePath(prefix)
+	for _, f := range sc.Files {
+		if hasPathPrefix(normalizePath(f.Path), prefix, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDateRange compares YYYY-MM-DD dates as strings. Undated scenes never match.
+func inDateRange(date *string, from, to string) bool {
+	d := normDate(derefStr(date))
+	if d == "" {
+		return false
+	}
+	return (from == "" || d >= from) && (to == "" || d <= to)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is anything the importer can read a library from. IDs are opaque strings
+// owned by the source and are what IDMap records, so they must be stable across runs.
+type Source interface {
+	// Name identifies the source in logs and is sent to GoonHub as the scene origin.
+	Name() string
+	Tags() ([]SourceTag, error)
+	Studios() ([]SourceStudio, error)
+	Performers() ([]SourcePerformer, error)
+	Scenes() ([]SourceScene, error)
+	Markers() ([]SourceMarker, error)
+}
+
+// IDSource is implemented by sources that can fetch specific entities by ID. ids
+// is keyed by phase ("Tags", "Studios", "Actors", "Scenes", "Markers").
+type IDSource interface {
+	FetchByID(ids map[string][]string) (*SourceData, error)
+}
+
+// SavedFilterSource is implemented by sources with filters saved in their own UI:
+// they can select scenes with one, and list them for migration to GoonHub.
+type SavedFilterSource interface {
+	SavedFilterScenes(nameOrID string) ([]SourceScene, error)
+	SavedFilters() ([]SourceSavedFilter, error)
+}
+
+// OpenSource builds the Source selected by cfg.Source.
+func OpenSource(cfg *Config) (Source, error) {
+	switch cfg.Source {
+	case "nfo":
+		fmt.Printf("[Config]  Source:  NFO sidecars under %s\n", cfg.NFORoot)
+		return NewNFOSource(cfg.NFORoot)
+	case "manifest":
+		fmt.Printf("[Config]  Source:  manifest %s\n", cfg.ManifestFile)
+		return NewManifestSource(cfg.ManifestFile)
+	default:
+		if cfg.StashDBPath != "" {
+			fmt.Printf("[Config]  Stash:   %s (SQLite, read-only)\n", cfg.StashDBPath)
+			db, err := OpenStashDB(cfg.StashDBPath)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("[Config]  Stash database schema version %d\n", db.SchemaVersion())
+			return NewStashSource(db), nil
+		}
+		fmt.Printf("[Config]  Stash:   %s\n", cfg.StashBaseURL)
+		return NewStashSource(NewStashClient(cfg.StashBaseURL, cfg.StashAPIKey)), nil
+	}
+}
+
+// Source-neutral domain types. Values are already normalised to what GoonHub
+// expects (e.g. lowercase gender values, ratings on a 0-100 scale).
+
+type SourceTag struct {
+	ID   string
+	Name string
+}
+
+type SourceStudio struct {
+	ID        string
+	Name      string
+	URLs      []string
+	Details   string
+	Rating100 *int
+	ParentID  string
+}
+
+type SourcePerformer struct {
+	ID           string
+	Name         string
+	Gender       string
+	Birthday     *string
+	DateOfDeath  *string
+	Ethnicity    string
+	Nationality  string
+	HeightCm     *int
+	WeightKg     *int
+	Measurements string
+	HairColor    string
+	EyeColor     string
+	Tattoos      string
+	Piercings    string
+	FakeBoobs    bool
+	ImageURL     string
+}
+
+type SourceScene struct {
+	ID           string
+	Title        string
+	Details      string
+	Date         *string
+	Rating100    *int
+	OCounter     *int
+	Files        []SourceFile
+	StudioID     string
+	PerformerIDs []string
+	TagIDs       []string
+}
+
+type SourceFile struct {
+	Path       string
+	Basename   string
+	Size       int64
+	Duration   float64
+	Width      int
+	Height     int
+	VideoCodec string
+	AudioCodec string
+	FrameRate  float64
+	BitRate    int64
+	// OSHash is the file's OpenSubtitles hash, when the source knows it.
+	OSHash string
+}
+
+type SourceMarker struct {
+	ID           string
+	SceneID      string
+	Title        string
+	Seconds      float64
+	PrimaryTagID string
+	TagIDs       []string
+}
+
+// SourceSavedFilter is a saved scene filter. Criteria stay in the source's own
+// format (for Stash, the UI's object_filter) and are translated by
+// translateSavedFilter.
+type SourceSavedFilter struct {
+	ID       string
+	Name     string
+	Query    string
+	Criteria map[string]any
+}
+
+// nameID derives a stable ID for sources that identify entities only by name.
+func nameID(source, name string) string {
+	return source + ":" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// ownsID reports whether an IDMap key was produced by the named source. Stash IDs
+// are bare; every other source namespaces its IDs as "<source>:...".
+func ownsID(source, id string) bool {
+	if source == "stash" {
+		return !strings.Contains(id, ":")
+	}
+	return strings.HasPrefix(id, source+":")
+}
+
+// markersForScenes returns the markers belonging to the given scenes.
+func markersForScenes(markers []SourceMarker, scenes []SourceScene) []SourceMarker {
+	keep := make(map[string]bool, len(scenes))
+	for _, sc := range scenes {
+		keep[sc.ID] = true
+	}
+	var out []SourceMarker
+	for _, m := range markers {
+		if keep[m.SceneID] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -9,6 +9,26 @@ import (
 	"time"
 )
 
+// StashReader is implemented by both the GraphQL client and the SQLite reader.
+type StashReader interface {
+	FetchTags() ([]StashTag, error)
+	FetchStudios() ([]StashStudio, error)
+	FetchPerformers() ([]StashPerformer, error)
+	FetchScenes() ([]StashScene, error)
+	FetchMarkers() ([]StashMarker, error)
+}
+
+// StashIDReader is implemented by readers that can look entities up by ID, so
+// retry-failed can re-read just what failed instead of the whole library.
+type StashIDReader interface {
+	FetchTagsByID(ids []string) ([]StashTag, error)
+	FetchStudiosByID(ids []string) ([]StashStudio, error)
+	FetchPerformersByID(ids []string) ([]StashPerformer, error)
+	FetchScenesByID(ids []string) ([]StashScene, error)
+	FetchMarkersByID(ids []string) ([]StashMarker, error)
+	FetchMarkersForScenes(sceneIDs []string) ([]StashMarker, error)
+}
+
 type StashClient struct {
 	baseURL string
 	apiKey  string
@@ -26,7 +46,14 @@ func NewStashClient(baseURL, apiKey string) *StashClient {
 }
 
 func (c *StashClient) query(queryStr string, result any) error {
-	body := map[string]string{"query": queryStr}
+	return c.queryWithVars(queryStr, nil, result)
+}
+
+func (c *StashClient) queryWithVars(queryStr string, variables map[string]any, result any) error {
+	body := map[string]any{"query": queryStr}
+	if variables != nil {
+		body["variables"] = variables
+	}
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal query: %w", err)
@@ -62,17 +89,26 @@ func (c *StashClient) query(queryStr string, result any) error {
 }
 
 func (c *StashClient) FetchTags() ([]StashTag, error) {
-	q := `{
-		findTags(filter: { per_page: -1 }) {
+	return c.fetchTags(nil)
+}
+
+func (c *StashClient) FetchTagsByID(ids []string) ([]StashTag, error) {
+	return c.fetchTags(ids)
+}
+
+func (c *StashClient) fetchTags(ids []string) ([]StashTag, error) {
+	q := `query%s {
+		findTags(%sfilter: { per_page: -1 }) {
 			tags {
 				id
 				name
+				updated_at
 			}
 		}
 	}`
 
 	var resp graphqlResponse[findTagsData]
-	if err := c.query(q, &resp); err != nil {
+	if err := c.find(q, ids, &resp); err != nil {
 		return nil, fmt.Errorf("failed to fetch tags: %w", err)
 	}
 	if len(resp.Errors) > 0 {
@@ -82,8 +118,16 @@ func (c *StashClient) FetchTags() ([]StashTag, error) {
 }
 
 func (c *StashClient) FetchStudios() ([]StashStudio, error) {
-	q := `{
-		findStudios(filter: { per_page: -1 }) {
+	return c.fetchStudios(nil)
+}
+
+func (c *StashClient) FetchStudiosByID(ids []string) ([]StashStudio, error) {
+	return c.fetchStudios(ids)
+}
+
+func (c *StashClient) fetchStudios(ids []string) ([]StashStudio, error) {
+	q := `query%s {
+		findStudios(%sfilter: { per_page: -1 }) {
 			studios {
 				id
 				name
@@ -96,7 +140,7 @@ func (c *StashClient) FetchStudios() ([]StashStudio, error) {
 	}`
 
 	var resp graphqlResponse[findStudiosData]
-	if err := c.query(q, &resp); err != nil {
+	if err := c.find(q, ids, &resp); err != nil {
 		return nil, fmt.Errorf("failed to fetch studios: %w", err)
 	}
 	if len(resp.Errors) > 0 {
@@ -106,8 +150,16 @@ func (c *StashClient) FetchStudios() ([]StashStudio, error) {
 }
 
 func (c *StashClient) FetchPerformers() ([]StashPerformer, error) {
-	q := `{
-		findPerformers(filter: { per_page: -1 }) {
+	return c.fetchPerformers(nil)
+}
+
+func (c *StashClient) FetchPerformersByID(ids []string) ([]StashPerformer, error) {
+	return c.fetchPerformers(ids)
+}
+
+func (c *StashClient) fetchPerformers(ids []string) ([]StashPerformer, error) {
+	q := `query%s {
+		findPerformers(%sfilter: { per_page: -1 }) {
 			performers {
 				id
 				name
@@ -125,12 +177,13 @@ func (c *StashClient) FetchPerformers() ([]StashPerformer, error) {
 				hair_color
 				weight
 				image_path
+				updated_at
 			}
 		}
 	}`
 
 	var resp graphqlResponse[findPerformersData]
-	if err := c.query(q, &resp); err != nil {
+	if err := c.find(q, ids, &resp); err != nil {
 		return nil, fmt.Errorf("failed to fetch performers: %w", err)
 	}
 	if len(resp.Errors) > 0 {
@@ -140,8 +193,25 @@ func (c *StashClient) FetchPerformers() ([]StashPerformer, error) {
 }
 
 func (c *StashClient) FetchScenes() ([]StashScene, error) {
-	q := `{
-		findScenes(filter: { per_page: -1 }) {
+	return c.fetchScenes("", "filter: { per_page: -1 }", nil)
+}
+
+func (c *StashClient) FetchScenesByID(ids []string) ([]StashScene, error) {
+	return c.fetchScenes("($ids: [ID!])", "ids: $ids, filter: { per_page: -1 }", map[string]any{"ids": ids})
+}
+
+// FetchScenesMatching returns every scene matched by a find filter and scene
+// filter, e.g. those of a saved filter.
+func (c *StashClient) FetchScenesMatching(filter, sceneFilter map[string]any) ([]StashScene, error) {
+	return c.fetchScenes("($filter: FindFilterType, $scene_filter: SceneFilterType)",
+		"filter: $filter, scene_filter: $scene_filter",
+		map[string]any{"filter": filter, "scene_filter": sceneFilter})
+}
+
+// fetchScenes runs findScenes with extra variable declarations and arguments.
+func (c *StashClient) fetchScenes(decl, args string, vars map[string]any) ([]StashScene, error) {
+	q := fmt.Sprintf(`query%s {
+		findScenes(%s) {
 			scenes {
 				id
 				title
@@ -160,23 +230,18 @@ func (c *StashClient) FetchScenes() ([]StashScene, error) {
 					frame_rate
 					bit_rate
 					basename
+					oshash: fingerprint(type: "oshash")
 				}
 				studio { id }
 				performers { id }
 				tags { id }
-				scene_markers {
-					id
-					title
-					seconds
-					primary_tag { id }
-					tags { id }
-				}
+				updated_at
 			}
 		}
-	}`
+	}`, decl, args)
 
 	var resp graphqlResponse[findScenesData]
-	if err := c.query(q, &resp); err != nil {
+	if err := c.queryWithVars(q, vars, &resp); err != nil {
 		return nil, fmt.Errorf("failed to fetch scenes: %w", err)
 	}
 	if len(resp.Errors) > 0 {
@@ -184,3 +249,103 @@ func (c *StashClient) FetchScenes() ([]StashScene, error) {
 	}
 	return resp.Data.FindScenes.Scenes, nil
 }
+
+func (c *StashClient) FetchMarkers() ([]StashMarker, error) {
+	return c.fetchMarkers("", "", nil)
+}
+
+func (c *StashClient) FetchMarkersByID(ids []string) ([]StashMarker, error) {
+	return c.fetchMarkers("($ids: [ID!])", "ids: $ids, ", map[string]any{"ids": ids})
+}
+
+func (c *StashClient) FetchMarkersForScenes(sceneIDs []string) ([]StashMarker, error) {
+	return c.fetchMarkers("($scenes: [ID!])",
+		"scene_marker_filter: { scenes: { value: $scenes, modifier: INCLUDES } }, ",
+		map[string]any{"scenes": sceneIDs})
+}
+
+// fetchMarkers runs findSceneMarkers with extra variable declarations and arguments.
+func (c *StashClient) fetchMarkers(decl, args string, vars map[string]any) ([]StashMarker, error) {
+	q := fmt.Sprintf(`query%s {
+		findSceneMarkers(%sfilter: { per_page: -1 }) {
+			scene_markers {
+				id
+				title
+				seconds
+				scene { id }
+				primary_tag { id }
+				tags { id }
+			}
+		}
+	}`, decl, args)
+
+	var resp graphqlResponse[findSceneMarkersData]
+	if err := c.queryWithVars(q, vars, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch scene markers: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("graphql errors: %s", resp.Errors[0].Message)
+	}
+	return resp.Data.FindSceneMarkers.SceneMarkers, nil
+}
+
+// find runs a findX query whose text has two %s verbs: one for the variable
+// declarations and one for the arguments. With ids it selects just those entities;
+// with nil it fetches everything.
+func (c *StashClient) find(q string, ids []string, result any) error {
+	if ids == nil {
+		return c.query(fmt.Sprintf(q, "", ""), result)
+	}
+	return c.queryWithVars(fmt.Sprintf(q, "($ids: [ID!])", "ids: $ids, "), map[string]any{"ids": ids}, result)
+}
+
+// FetchSavedFilters returns the saved filters of one mode (e.g. "SCENES").
+func (c *StashClient) FetchSavedFilters(mode string) ([]StashSavedFilter, error) {
+	q := `query($mode: FilterMode) {
+		findSavedFilters(mode: $mode) {
+			id
+			mode
+			name
+			find_filter { q sort direction }
+			object_filter
+		}
+	}`
+
+	var resp graphqlResponse[findSavedFiltersData]
+	if err := c.queryWithVars(q, map[string]any{"mode": mode}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch saved filters: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("graphql errors: %s", resp.Errors[0].Message)
+	}
+	return resp.Data.FindSavedFilters, nil
+}
+
+// --- Mutations ---
+
+func (c *StashClient) UpdateTag(input map[string]any) error {
+	return c.mutate("tagUpdate", "TagUpdateInput", input)
+}
+
+func (c *StashClient) UpdatePerformer(input map[string]any) error {
+	return c.mutate("performerUpdate", "PerformerUpdateInput", input)
+}
+
+func (c *StashClient) UpdateScene(input map[string]any) error {
+	return c.mutate("sceneUpdate", "SceneUpdateInput", input)
+}
+
+// mutate runs a single-input update mutation. input must include "id"; fields
+// left out are not touched by Stash.
+func (c *StashClient) mutate(name, inputType string, input map[string]any) error {
+	q := fmt.Sprintf("mutation($input: %s!) { %s(input: $input) { id } }", inputType, name)
+
+	var resp graphqlResponse[map[string]any]
+	if err := c.queryWithVars(q, map[string]any{"input": input}, &resp); err != nil {
+		return fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql errors: %s", resp.Errors[0].Message)
+	}
+	return nil
+}
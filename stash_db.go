@@ -0,0 +1,435 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Stash schema versions (golang-migrate "schema_migrations" table) this reader understands.
+// 32 is the files refactor that introduced files/folders/scenes_files.
+const (
+	minStashSchemaVersion = 32
+	maxStashSchemaVersion = 75
+)
+
+// StashDB reads directly from Stash's SQLite database (stash-go.sqlite) and returns
+// the same types as StashClient. The database is opened read-only.
+type StashDB struct {
+	db            *sql.DB
+	schemaVersion int
+}
+
+func OpenStashDB(path string) (*StashDB, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stash database: %w", err)
+	}
+
+	s := &StashDB{db: db}
+	if err := s.detectSchemaVersion(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StashDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *StashDB) SchemaVersion() int {
+	return s.schemaVersion
+}
+
+func (s *StashDB) detectSchemaVersion() error {
+	var version int
+	var dirty bool
+	err := s.db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("failed to read stash schema version (is this a stash-go.sqlite file?): %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("stash database schema version %d is marked dirty (a migration failed); restore a backup or let Stash finish migrating", version)
+	}
+	if version < minStashSchemaVersion || version > maxStashSchemaVersion {
+		return fmt.Errorf("unsupported stash database schema version %d (supported: %d-%d)", version, minStashSchemaVersion, maxStashSchemaVersion)
+	}
+	s.schemaVersion = version
+	return nil
+}
+
+func (s *StashDB) FetchTags() ([]StashTag, error) {
+	rows, err := s.db.Query("SELECT id, name FROM tags ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []StashTag
+	for rows.Next() {
+		var id int64
+		var t StashTag
+		if err := rows.Scan(&id, &t.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		t.ID = dbID(id)
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *StashDB) FetchStudios() ([]StashStudio, error) {
+	urls, err := s.studioURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT id, name, details, rating, parent_id FROM studios ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch studios: %w", err)
+	}
+	defer rows.Close()
+
+	var studios []StashStudio
+	for rows.Next() {
+		var id int64
+		var details sql.NullString
+		var rating, parentID sql.NullInt64
+		var st StashStudio
+		if err := rows.Scan(&id, &st.Name, &details, &rating, &parentID); err != nil {
+			return nil, fmt.Errorf("failed to scan studio: %w", err)
+		}
+		st.ID = dbID(id)
+		st.Details = details.String
+		st.Rating100 = nullInt(rating)
+		st.URLs = urls[st.ID]
+		if parentID.Valid {
+			st.ParentStudio = &StashIDRef{ID: dbID(parentID.Int64)}
+		}
+		studios = append(studios, st)
+	}
+	return studios, rows.Err()
+}
+
+// studioURLs returns studio URLs keyed by studio ID. Newer schemas keep them in
+// studio_urls; older ones have a single studios.url column.
+func (s *StashDB) studioURLs() (map[string][]string, error) {
+	q := "SELECT studio_id, url FROM studio_urls ORDER BY studio_id, position"
+	if ok, err := s.hasTable("studio_urls"); err != nil {
+		return nil, err
+	} else if !ok {
+		q = "SELECT id, url FROM studios WHERE url IS NOT NULL AND url != ''"
+	}
+
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch studio urls: %w", err)
+	}
+	defer rows.Close()
+
+	urls := make(map[string][]string)
+	for rows.Next() {
+		var id int64
+		var u string
+		if err := rows.Scan(&id, &u); err != nil {
+			return nil, fmt.Errorf("failed to scan studio url: %w", err)
+		}
+		urls[dbID(id)] = append(urls[dbID(id)], u)
+	}
+	return urls, rows.Err()
+}
+
+func (s *StashDB) FetchPerformers() ([]StashPerformer, error) {
+	heightCol := "height"
+	if ok, err := s.hasColumn("performers", "height_cm"); err != nil {
+		return nil, err
+	} else if ok {
+		heightCol = "height_cm"
+	}
+
+	rows, err := s.db.Query(`SELECT id, name, gender, CAST(birthdate AS TEXT), CAST(death_date AS TEXT),
+		ethnicity, country, eye_color, CAST(` + heightCol + ` AS INTEGER), measurements, fake_tits,
+		tattoos, piercings, hair_color, weight
+		FROM performers ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch performers: %w", err)
+	}
+	defer rows.Close()
+
+	var performers []StashPerformer
+	for rows.Next() {
+		var id int64
+		var gender, birthdate, deathDate, ethnicity, country, eyeColor sql.NullString
+		var measurements, fakeTits, tattoos, piercings, hairColor sql.NullString
+		var height, weight sql.NullInt64
+		var p StashPerformer
+		if err := rows.Scan(&id, &p.Name, &gender, &birthdate, &deathDate, &ethnicity, &country, &eyeColor,
+			&height, &measurements, &fakeTits, &tattoos, &piercings, &hairColor, &weight); err != nil {
+			return nil, fmt.Errorf("failed to scan performer: %w", err)
+		}
+		p.ID = dbID(id)
+		p.Gender = nullStr(gender)
+		p.Birthdate = nullStr(birthdate)
+		p.DeathDate = nullStr(deathDate)
+		p.Ethnicity = nullStr(ethnicity)
+		p.Country = nullStr(country)
+		p.EyeColor = nullStr(eyeColor)
+		p.HeightCm = nullInt(height)
+		p.Measurements = nullStr(measurements)
+		p.FakeTits = nullStr(fakeTits)
+		p.Tattoos = nullStr(tattoos)
+		p.Piercings = nullStr(piercings)
+		p.HairColor = nullStr(hairColor)
+		p.Weight = nullInt(weight)
+		// ImagePath is a URL served by a running Stash instance, so it's left empty here.
+		performers = append(performers, p)
+	}
+	return performers, rows.Err()
+}
+
+func (s *StashDB) FetchScenes() ([]StashScene, error) {
+	rows, err := s.db.Query("SELECT id, title, details, CAST(date AS TEXT), rating, studio_id FROM scenes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scenes: %w", err)
+	}
+
+	var scenes []StashScene
+	index := make(map[string]int)
+	for rows.Next() {
+		var id int64
+		var title, details, date sql.NullString
+		var rating, studioID sql.NullInt64
+		if err := rows.Scan(&id, &title, &details, &date, &rating, &studioID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan scene: %w", err)
+		}
+		sc := StashScene{
+			ID:        dbID(id),
+			Title:     nullStr(title),
+			Details:   nullStr(details),
+			Date:      nullStr(date),
+			Rating100: nullInt(rating),
+		}
+		if studioID.Valid {
+			sc.Studio = &StashIDRef{ID: dbID(studioID.Int64)}
+		}
+		index[sc.ID] = len(scenes)
+		scenes = append(scenes, sc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch scenes: %w", err)
+	}
+
+	if err := s.loadSceneOCounters(scenes, index); err != nil {
+		return nil, err
+	}
+	if err := s.loadSceneFiles(scenes, index); err != nil {
+		return nil, err
+	}
+	if err := s.loadSceneRefs("SELECT scene_id, performer_id FROM performers_scenes ORDER BY scene_id, performer_id", scenes, index, func(sc *StashScene, ref StashIDRef) {
+		sc.Performers = append(sc.Performers, ref)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fetch scene performers: %w", err)
+	}
+	if err := s.loadSceneRefs("SELECT scene_id, tag_id FROM scenes_tags ORDER BY scene_id, tag_id", scenes, index, func(sc *StashScene, ref StashIDRef) {
+		sc.Tags = append(sc.Tags, ref)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fetch scene tags: %w", err)
+	}
+
+	return scenes, nil
+}
+
+// loadSceneOCounters fills OCounter from scenes_o_dates (newer schemas) or the
+// legacy scenes.o_counter column.
+func (s *StashDB) loadSceneOCounters(scenes []StashScene, index map[string]int) error {
+	q := "SELECT scene_id, COUNT(*) FROM scenes_o_dates GROUP BY scene_id"
+	if ok, err := s.hasTable("scenes_o_dates"); err != nil {
+		return err
+	} else if !ok {
+		q = "SELECT id, o_counter FROM scenes"
+	}
+
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return fmt.Errorf("failed to fetch scene o-counters: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var count sql.NullInt64
+		if err := rows.Scan(&id, &count); err != nil {
+			return fmt.Errorf("failed to scan scene o-counter: %w", err)
+		}
+		if i, ok := index[dbID(id)]; ok {
+			scenes[i].OCounter = nullInt(count)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *StashDB) loadSceneFiles(scenes []StashScene, index map[string]int) error {
+	rows, err := s.db.Query(`SELECT sf.scene_id, fo.path, f.basename, f.size,
+		vf.duration, vf.width, vf.height, vf.video_codec, vf.audio_codec, vf.frame_rate, vf.bit_rate, fp.fingerprint
+		FROM scenes_files sf
+		JOIN files f ON f.id = sf.file_id
+		JOIN folders fo ON fo.id = f.parent_folder_id
+		LEFT JOIN video_files vf ON vf.file_id = f.id
+		LEFT JOIN files_fingerprints fp ON fp.file_id = f.id AND fp.type = 'oshash'
+		ORDER BY sf.scene_id, sf."primary" DESC, f.id`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch scene files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sceneID int64
+		var folder, basename string
+		var size int64
+		var duration, frameRate sql.NullFloat64
+		var width, height, bitRate sql.NullInt64
+		var videoCodec, audioCodec, oshash sql.NullString
+		if err := rows.Scan(&sceneID, &folder, &basename, &size, &duration, &width, &height,
+			&videoCodec, &audioCodec, &frameRate, &bitRate, &oshash); err != nil {
+			return fmt.Errorf("failed to scan scene file: %w", err)
+		}
+		i, ok := index[dbID(sceneID)]
+		if !ok {
+			continue
+		}
+		scenes[i].Files = append(scenes[i].Files, StashFile{
+			Path:       joinStashPath(folder, basename),
+			Basename:   basename,
+			Size:       size,
+			Duration:   duration.Float64,
+			Width:      int(width.Int64),
+			Height:     int(height.Int64),
+			VideoCodec: videoCodec.String,
+			AudioCodec: audioCodec.String,
+			FrameRate:  frameRate.Float64,
+			BitRate:    bitRate.Int64,
+			OSHash:     nullStr(oshash),
+		})
+	}
+	return rows.Err()
+}
+
+func (s *StashDB) loadSceneRefs(q string, scenes []StashScene, index map[string]int, add func(*StashScene, StashIDRef)) error {
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sceneID, refID int64
+		if err := rows.Scan(&sceneID, &refID); err != nil {
+			return err
+		}
+		if i, ok := index[dbID(sceneID)]; ok {
+			add(&scenes[i], StashIDRef{ID: dbID(refID)})
+		}
+	}
+	return rows.Err()
+}
+
+func (s *StashDB) FetchMarkers() ([]StashMarker, error) {
+	markerTags := make(map[string][]StashIDRef)
+	tagRows, err := s.db.Query("SELECT scene_marker_id, tag_id FROM scene_markers_tags ORDER BY scene_marker_id, tag_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch marker tags: %w", err)
+	}
+	for tagRows.Next() {
+		var markerID, tagID int64
+		if err := tagRows.Scan(&markerID, &tagID); err != nil {
+			tagRows.Close()
+			return nil, fmt.Errorf("failed to scan marker tag: %w", err)
+		}
+		markerTags[dbID(markerID)] = append(markerTags[dbID(markerID)], StashIDRef{ID: dbID(tagID)})
+	}
+	tagRows.Close()
+	if err := tagRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch marker tags: %w", err)
+	}
+
+	rows, err := s.db.Query("SELECT id, scene_id, title, seconds, primary_tag_id FROM scene_markers ORDER BY scene_id, seconds, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scene markers: %w", err)
+	}
+	defer rows.Close()
+
+	var markers []StashMarker
+	for rows.Next() {
+		var id, sceneID int64
+		var primaryTagID sql.NullInt64
+		var m StashMarker
+		if err := rows.Scan(&id, &sceneID, &m.Title, &m.Seconds, &primaryTagID); err != nil {
+			return nil, fmt.Errorf("failed to scan scene marker: %w", err)
+		}
+		m.ID = dbID(id)
+		m.Scene = &StashIDRef{ID: dbID(sceneID)}
+		if primaryTagID.Valid {
+			m.PrimaryTag = &StashIDRef{ID: dbID(primaryTagID.Int64)}
+		}
+		m.Tags = markerTags[m.ID]
+		markers = append(markers, m)
+	}
+	return markers, rows.Err()
+}
+
+// --- Schema helpers ---
+
+func (s *StashDB) hasTable(name string) (bool, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect stash schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *StashDB) hasColumn(table, column string) (bool, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect stash schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// joinStashPath joins a folder path and basename using the separator the folder
+// path already uses, so Windows paths stay Windows paths.
+func joinStashPath(folder, basename string) string {
+	sep := "/"
+	if strings.Contains(folder, `\`) && !strings.Contains(folder, "/") {
+		sep = `\`
+	}
+	return strings.TrimRight(folder, sep) + sep + basename
+}
+
+func dbID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func nullStr(s sql.NullString) *string {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return &s.String
+}
+
+func nullInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
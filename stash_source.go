@@ -0,0 +1,259 @@
+package main
+
+import "strings"
+
+// StashSource adapts a StashReader (GraphQL API or SQLite database) to the Source interface.
+type StashSource struct {
+	reader StashReader
+}
+
+func NewStashSource(reader StashReader) *StashSource {
+	return &StashSource{reader: reader}
+}
+
+func (s *StashSource) Name() string {
+	return "stash"
+}
+
+func (s *StashSource) Tags() ([]SourceTag, error) {
+	tags, err := s.reader.FetchTags()
+	if err != nil {
+		return nil, err
+	}
+	return convertStashTags(tags), nil
+}
+
+func convertStashTags(tags []StashTag) []SourceTag {
+	out := make([]SourceTag, 0, len(tags))
+	for _, t := range tags {
+		out = append(out, SourceTag{ID: t.ID, Name: t.Name})
+	}
+	return out
+}
+
+func (s *StashSource) Studios() ([]SourceStudio, error) {
+	studios, err := s.reader.FetchStudios()
+	if err != nil {
+		return nil, err
+	}
+	return convertStashStudios(studios), nil
+}
+
+func convertStashStudios(studios []StashStudio) []SourceStudio {
+	out := make([]SourceStudio, 0, len(studios))
+	for _, st := range studios {
+		out = append(out, SourceStudio{
+			ID:        st.ID,
+			Name:      st.Name,
+			URLs:      st.URLs,
+			Details:   st.Details,
+			Rating100: st.Rating100,
+			ParentID:  refID(st.ParentStudio),
+		})
+	}
+	return out
+}
+
+func (s *StashSource) Performers() ([]SourcePerformer, error) {
+	performers, err := s.reader.FetchPerformers()
+	if err != nil {
+		return nil, err
+	}
+	return convertStashPerformers(performers), nil
+}
+
+func convertStashPerformers(performers []StashPerformer) []SourcePerformer {
+	out := make([]SourcePerformer, 0, len(performers))
+	for _, p := range performers {
+		out = append(out, SourcePerformer{
+			ID:           p.ID,
+			Name:         p.Name,
+			Gender:       mapGender(p.Gender),
+			Birthday:     p.Birthdate,
+			DateOfDeath:  p.DeathDate,
+			Ethnicity:    derefStr(p.Ethnicity),
+			Nationality:  derefStr(p.Country),
+			HeightCm:     p.HeightCm,
+			WeightKg:     p.Weight,
+			Measurements: derefStr(p.Measurements),
+			HairColor:    derefStr(p.HairColor),
+			EyeColor:     derefStr(p.EyeColor),
+			Tattoos:      derefStr(p.Tattoos),
+			Piercings:    derefStr(p.Piercings),
+			FakeBoobs:    isFakeBoobs(p.FakeTits),
+			ImageURL:     derefStr(p.ImagePath),
+		})
+	}
+	return out
+}
+
+func (s *StashSource) Scenes() ([]SourceScene, error) {
+	scenes, err := s.reader.FetchScenes()
+	if err != nil {
+		return nil, err
+	}
+	return convertStashScenes(scenes), nil
+}
+
+func convertStashScenes(scenes []StashScene) []SourceScene {
+	out := make([]SourceScene, 0, len(scenes))
+	for _, sc := range scenes {
+		out = append(out, convertStashScene(sc))
+	}
+	return out
+}
+
+func (s *StashSource) Markers() ([]SourceMarker, error) {
+	markers, err := s.reader.FetchMarkers()
+	if err != nil {
+		return nil, err
+	}
+	return convertStashMarkers(markers), nil
+}
+
+func convertStashMarkers(markers []StashMarker) []SourceMarker {
+	out := make([]SourceMarker, 0, len(markers))
+	for _, m := range markers {
+		out = append(out, SourceMarker{
+			ID:           m.ID,
+			SceneID:      refID(m.Scene),
+			Title:        m.Title,
+			Seconds:      m.Seconds,
+			PrimaryTagID: refID(m.PrimaryTag),
+			TagIDs:       refIDs(m.Tags),
+		})
+	}
+	return out
+}
+
+// FetchByID implements IDSource when the reader supports ID lookups (the GraphQL
+// API does, the SQLite reader doesn't). Markers of the requested scenes are
+// included along with the requested markers.
+func (s *StashSource) FetchByID(ids map[string][]string) (*SourceData, error) {
+	r, ok := s.reader.(StashIDReader)
+	if !ok {
+		return nil, errNoIDLookup
+	}
+
+	var data SourceData
+	if len(ids["Tags"]) > 0 {
+		tags, err := r.FetchTagsByID(ids["Tags"])
+		if err != nil {
+			return nil, err
+		}
+		data.Tags = convertStashTags(tags)
+	}
+	if len(ids["Studios"]) > 0 {
+		studios, err := r.FetchStudiosByID(ids["Studios"])
+		if err != nil {
+			return nil, err
+		}
+		data.Studios = convertStashStudios(studios)
+	}
+	if len(ids["Actors"]) > 0 {
+		performers, err := r.FetchPerformersByID(ids["Actors"])
+		if err != nil {
+			return nil, err
+		}
+		data.Performers = convertStashPerformers(performers)
+	}
+	if len(ids["Scenes"]) > 0 {
+		scenes, err := r.FetchScenesByID(ids["Scenes"])
+		if err != nil {
+			return nil, err
+		}
+		data.Scenes = convertStashScenes(scenes)
+
+		markers, err := r.FetchMarkersForScenes(ids["Scenes"])
+		if err != nil {
+			return nil, err
+		}
+		data.Markers = convertStashMarkers(markers)
+	}
+	if len(ids["Markers"]) > 0 {
+		markers, err := r.FetchMarkersByID(ids["Markers"])
+		if err != nil {
+			return nil, err
+		}
+		data.Markers = mergeMarkers(data.Markers, convertStashMarkers(markers))
+	}
+	return &data, nil
+}
+
+func convertStashScene(sc StashScene) SourceScene {
+	files := make([]SourceFile, 0, len(sc.Files))
+	for _, f := range sc.Files {
+		files = append(files, SourceFile{
+			Path:       f.Path,
+			Basename:   f.Basename,
+			Size:       f.Size,
+			Duration:   f.Duration,
+			Width:      f.Width,
+			Height:     f.Height,
+			VideoCodec: f.VideoCodec,
+			AudioCodec: f.AudioCodec,
+			FrameRate:  f.FrameRate,
+			BitRate:    f.BitRate,
+			OSHash:     derefStr(f.OSHash),
+		})
+	}
+	return SourceScene{
+		ID:           sc.ID,
+		Title:        derefStr(sc.Title),
+		Details:      derefStr(sc.Details),
+		Date:         sc.Date,
+		Rating100:    sc.Rating100,
+		OCounter:     sc.OCounter,
+		Files:        files,
+		StudioID:     refID(sc.Studio),
+		PerformerIDs: refIDs(sc.Performers),
+		TagIDs:       refIDs(sc.Tags),
+	}
+}
+
+// --- Helpers ---
+
+func refID(ref *StashIDRef) string {
+	if ref == nil {
+		return ""
+	}
+	return ref.ID
+}
+
+func refIDs(refs []StashIDRef) []string {
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ids = append(ids, ref.ID)
+	}
+	return ids
+}
+
+func mapGender(g *string) string {
+	if g == nil {
+		return ""
+	}
+	switch strings.ToUpper(*g) {
+	case "MALE":
+		return "male"
+	case "FEMALE":
+		return "female"
+	case "TRANSGENDER_MALE":
+		return "transgender_male"
+	case "TRANSGENDER_FEMALE":
+		return "transgender_female"
+	case "INTERSEX":
+		return "intersex"
+	case "NON_BINARY":
+		return "non_binary"
+	default:
+		return strings.ToLower(*g)
+	}
+}
+
+func isFakeBoobs(fakeTits *string) bool {
+	if fakeTits == nil {
+		return false
+	}
+	v := strings.ToLower(*fakeTits)
+	return v != "" && v != "natural"
+}
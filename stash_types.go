@@ -1,10 +1,13 @@
 package main
 
+import "time"
+
 // Stash GraphQL response types
 
 type StashTag struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type StashStudio struct {
@@ -37,6 +40,7 @@ type StashPerformer struct {
 	HairColor    *string `json:"hair_color"`
 	Weight       *int    `json:"weight"`
 	ImagePath    *string `json:"image_path"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type StashScene struct {
@@ -50,7 +54,7 @@ type StashScene struct {
 	Studio       *StashIDRef     `json:"studio"`
 	Performers   []StashIDRef    `json:"performers"`
 	Tags         []StashIDRef    `json:"tags"`
-	SceneMarkers []StashMarker   `json:"scene_markers"`
+	UpdatedAt    time.Time       `json:"updated_at"`
 }
 
 type StashFile struct {
@@ -64,16 +68,34 @@ type StashFile struct {
 	FrameRate  float64 `json:"frame_rate"`
 	BitRate    int64   `json:"bit_rate"`
 	Basename   string  `json:"basename"`
+	OSHash     *string `json:"oshash"`
 }
 
 type StashMarker struct {
 	ID         string       `json:"id"`
 	Title      string       `json:"title"`
 	Seconds    float64      `json:"seconds"`
+	Scene      *StashIDRef  `json:"scene"`
 	PrimaryTag *StashIDRef  `json:"primary_tag"`
 	Tags       []StashIDRef `json:"tags"`
 }
 
+// StashSavedFilter is a filter saved in the Stash UI. ObjectFilter is stored in
+// the UI's criterion format; see sceneFilterFromSaved.
+type StashSavedFilter struct {
+	ID           string                `json:"id"`
+	Mode         string                `json:"mode"`
+	Name         string                `json:"name"`
+	FindFilter   *StashSavedFindFilter `json:"find_filter"`
+	ObjectFilter map[string]any        `json:"object_filter"`
+}
+
+type StashSavedFindFilter struct {
+	Q         *string `json:"q"`
+	Sort      *string `json:"sort"`
+	Direction *string `json:"direction"`
+}
+
 // GraphQL response wrappers
 
 type graphqlResponse[T any] struct {
@@ -108,3 +130,13 @@ type findScenesData struct {
 		Scenes []StashScene `json:"scenes"`
 	} `json:"findScenes"`
 }
+
+type findSceneMarkersData struct {
+	FindSceneMarkers struct {
+		SceneMarkers []StashMarker `json:"scene_markers"`
+	} `json:"findSceneMarkers"`
+}
+
+type findSavedFiltersData struct {
+	FindSavedFilters []StashSavedFilter `json:"findSavedFilters"`
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkStoragePaths validates path mappings against GoonHub's storage paths: a
+// storage_path_id must exist, and the GoonHub side of the mapping must lie under
+// that storage path. Mappings without a storage_path_id get the ID of the
+// deepest storage path containing their GoonHub side. Returns the indexes of the
+// mappings whose ID was inferred.
+func checkStoragePaths(mappings []PathMapping, paths []GHStoragePath) ([]int, error) {
+	byID := make(map[uint]GHStoragePath, len(paths))
+	for _, sp := range paths {
+		byID[sp.ID] = sp
+	}
+
+	var inferred []int
+	var problems []string
+	for i := range mappings {
+		m := &mappings[i]
+		label := mappingLabel(*m)
+		dir := mappingTargetDir(*m)
+
+		if m.StoragePathID == 0 {
+			if dir == "" {
+				continue
+			}
+			if sp, ok := containingStoragePath(dir, paths); ok {
+				m.StoragePathID = sp.ID
+				inferred = append(inferred, i)
+				fmt.Printf("[Storage] %s: using storage path %d (%s, %s)\n", label, sp.ID, sp.Name, sp.Path)
+			} else {
+				fmt.Printf("[Storage] WARNING: %s: no storage path contains %s, GoonHub's default will be used\n", label, dir)
+			}
+			continue
+		}
+
+		sp, ok := byID[m.StoragePathID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: storage path %d doesn't exist", label, m.StoragePathID))
+			continue
+		}
+		if dir != "" && !hasPathPrefix(dir, normalizePath(sp.Path), false) {
+			problems = append(problems, fmt.Sprintf("%s: %s is not under storage path %d (%s)", label, dir, sp.ID, sp.Path))
+		}
+	}
+
+	if len(problems) > 0 {
+		var b strings.Builder
+		b.WriteString("path mappings don't match GoonHub's storage paths:")
+		for _, p := range problems {
+			b.WriteString("\n  " + p)
+		}
+		b.WriteString("\nAvailable storage paths:")
+		for _, sp := range paths {
+			fmt.Fprintf(&b, "\n  %d  %-20s %s", sp.ID, sp.Name, sp.Path)
+		}
+		return inferred, fmt.Errorf("%s", b.String())
+	}
+	return inferred, nil
+}
+
+// mappingTargetDir returns the normalised directory a mapping's paths land in:
+// the goonhub_prefix, or the literal directories of goonhub_path before its
+// first capture group reference. Returns "" when that isn't known.
+func mappingTargetDir(m PathMapping) string {
+	target := m.GoonHubPrefix
+	if m.StashRegex != "" {
+		target = m.GoonHubPath
+		if i := strings.Index(target, "$"); i >= 0 {
+			target = target[:i]
+			target = target[:strings.LastIndexAny(target, `/\`)+1]
+		}
+	}
+	if target == "" {
+		return ""
+	}
+	return normalizePath(target)
+}
+
+// containingStoragePath returns the storage path with the longest path that dir
+// is under.
+func containingStoragePath(dir string, paths []GHStoragePath) (GHStoragePath, bool) {
+	var best GHStoragePath
+	found := false
+	for _, sp := range paths {
+		p := normalizePath(sp.Path)
+		if hasPathPrefix(dir, p, false) && (!found || len(p) > len(normalizePath(best.Path))) {
+			best, found = sp, true
+		}
+	}
+	return best, found
+}
+
+// mustCheckStoragePaths validates cfg.PathMappings against GoonHub's storage
+// paths, exiting on a mismatch. Inferred storage path IDs are used for this run
+// only; storage-paths --save writes them to the mappings file.
+func mustCheckStoragePaths(cfg *Config, gh *GoonHubClient) {
+	paths, err := gh.ListStoragePaths()
+	if err != nil {
+		fmt.Printf("[Storage] WARNING: can't check path mappings against GoonHub's storage paths: %v\n", err)
+		return
+	}
+	inferred, err := checkStoragePaths(cfg.PathMappings, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(inferred) > 0 {
+		fmt.Printf("[Storage] Run storage-paths --save to write the %d inferred storage_path_id(s) to %s\n", len(inferred), cfg.MappingsFile)
+	}
+}
+
+// runStoragePaths lists GoonHub's storage paths and checks the mappings against
+// them. With --save, inferred storage path IDs are written to the mappings file.
+func runStoragePaths(cfg *Config, args []string) {
+	fs := flag.NewFlagSet("storage-paths", flag.ExitOnError)
+	save := fs.Bool("save", false, "write inferred storage_path_ids to the mappings file")
+	_ = fs.Parse(args)
+
+	mappings, err := LoadMappings(cfg.MappingsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[Config]  Loaded %d path mapping(s)\n", len(mappings))
+
+	gh := mustLoginGoonHub(cfg)
+	paths, err := gh.ListStoragePaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Storage paths error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("\n[Storage] GoonHub storage paths:")
+	for _, sp := range paths {
+		def := ""
+		if sp.IsDefault {
+			def = " (default)"
+		}
+		fmt.Printf("[Storage]   %d  %-20s %s%s\n", sp.ID, sp.Name, sp.Path, def)
+	}
+
+	inferred, err := checkStoragePaths(mappings, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(inferred) == 0:
+		fmt.Printf("\nNo storage_path_id to infer; %s is unchanged.\n", cfg.MappingsFile)
+	case !*save:
+		fmt.Printf("\nNo changes made. Run again with --save to write the %d inferred storage_path_id(s) to %s.\n", len(inferred), cfg.MappingsFile)
+	case cfg.DryRun:
+		fmt.Printf("\n[DRY RUN] Would save %d inferred storage_path_id(s) to %s\n", len(inferred), cfg.MappingsFile)
+	default:
+		if err := SaveMappings(cfg.MappingsFile, mappings); err != nil {
+			fmt.Fprintf(os.Stderr, "Mappings error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n[Storage] Saved %d inferred storage_path_id(s) to %s\n", len(inferred), cfg.MappingsFile)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conflict resolution strategies for fields edited on both sides since the last sync.
+const (
+	resolveAsk     = "ask"
+	resolveStash   = "stash"
+	resolveGoonHub = "goonhub"
+	resolveNewest  = "newest"
+)
+
+// Sync propagates edits in both directions for entities paired in IDMap. Each side
+// is compared against the snapshot taken at the last sync: a field changed on one
+// side only is copied to the other, a field changed on both is a conflict.
+type Sync struct {
+	stash      *StashClient
+	gh         *GoonHubClient
+	idMap      *IDMap
+	state      *SyncState
+	collector  *pairCollector
+	resolution string
+	prompt     *bufio.Reader
+}
+
+// SyncPlan is the work for one paired entity. Values are in Stash terms.
+type SyncPlan struct {
+	Pair      EntityPair
+	ToGH      entityFields
+	ToStash   entityFields
+	Agreed    entityFields
+	Conflicts []FieldConflict
+}
+
+// FieldConflict is a field whose value differs on both sides from the snapshot
+// (or that differs with no snapshot to decide from).
+type FieldConflict struct {
+	Field string
+	Base  string
+	Stash string
+	GH    string
+	// Resolution is "stash", "goonhub" or "" while unresolved.
+	Resolution string
+}
+
+func runSync(cfg *Config, args []string) {
+	defaultResolution := cfg.SyncResolution
+	if defaultResolution == "" {
+		defaultResolution = resolveAsk
+	}
+
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "write the changes to both sides (default: print the plan only)")
+	resolution := fs.String("resolve", defaultResolution, "conflict resolution: ask, stash, goonhub or newest")
+	_ = fs.Parse(args)
+
+	switch *resolution {
+	case resolveAsk, resolveStash, resolveGoonHub, resolveNewest:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --resolve %q (expected ask, stash, goonhub or newest)\n", *resolution)
+		os.Exit(2)
+	}
+	if cfg.StashBaseURL == "" || cfg.StashAPIKey == "" {
+		fmt.Fprintln(os.Stderr, "sync requires STASH_BASE_URL and STASH_API_KEY (the SQLite reader is read-only)")
+		os.Exit(1)
+	}
+	if *apply && cfg.DryRun {
+		fmt.Println("[Config]  DRY_RUN=true overrides --apply - no changes will be made")
+		*apply = false
+	}
+
+	rules := mustLoadImportRules(cfg)
+	idMap := mustLoadIDMap(cfg)
+	state, err := LoadSyncState(cfg.SyncStateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sync state error: %v\n", err)
+		os.Exit(1)
+	}
+	if !state.LastSync.IsZero() {
+		fmt.Printf("[Config]  Last sync: %s\n", state.LastSync.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("[Config]  Conflict resolution: %s\n", *resolution)
+	fmt.Printf("[Config]  Stash:   %s\n", cfg.StashBaseURL)
+	fmt.Printf("[Config]  GoonHub: %s\n", cfg.GoonHubBaseURL)
+	ghClient := mustLoginGoonHub(cfg)
+
+	stash := NewStashClient(cfg.StashBaseURL, cfg.StashAPIKey)
+	s := &Sync{
+		stash:      stash,
+		gh:         ghClient,
+		idMap:      idMap,
+		state:      state,
+		collector:  newPairCollector(stash, ghClient, idMap, rules, time.Time{}, "Sync"),
+		resolution: *resolution,
+	}
+	// Only prompt when the answers will be used.
+	if *apply && *resolution == resolveAsk {
+		s.prompt = bufio.NewReader(os.Stdin)
+	}
+
+	plans, err := s.Plan()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sync failed: %v\n", err)
+		os.Exit(1)
+	}
+	unresolved := printSyncPlans(plans)
+
+	if !*apply {
+		if len(plans) == 0 {
+			fmt.Println("\nStash and GoonHub are in sync.")
+		} else {
+			fmt.Println("\nNo changes made. Run again with --apply to sync.")
+		}
+		return
+	}
+
+	stats := PhaseStats{}
+	if len(plans) > 0 {
+		stats = s.Apply(plans)
+	}
+	s.state.LastSync = s.collector.started
+	if err := s.state.Save(cfg.SyncStateFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save sync state: %v\n", err)
+		os.Exit(1)
+	}
+	if len(plans) == 0 {
+		fmt.Println("\nStash and GoonHub are in sync.")
+		return
+	}
+	printStats("Sync", stats)
+	if unresolved > 0 {
+		fmt.Printf("[Sync]    %d conflicts left unresolved; run again with --resolve to settle them\n", unresolved)
+	}
+	if stats.Errors > 0 {
+		releaseIDMap()
+		os.Exit(1)
+	}
+}
+
+// Plan compares every paired entity against its snapshot and resolves conflicts
+// with the configured strategy. Entities already in sync are left out.
+func (s *Sync) Plan() ([]SyncPlan, error) {
+	pairs, err := s.collector.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []SyncPlan
+	for _, p := range pairs {
+		plan := planPair(p, s.state.snapshot(p.Kind, p.StashID), s.state.imported(p.Kind, p.StashID))
+		for i := range plan.Conflicts {
+			s.resolve(&plan, &plan.Conflicts[i])
+		}
+		if len(plan.ToGH) == 0 && len(plan.ToStash) == 0 && len(plan.Conflicts) == 0 {
+			// Nothing to write, but remember the agreed values for the next run.
+			s.state.record(p.Kind, p.StashID, plan.Agreed, p.Imported)
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// planPair works out which side each field should flow to. imported holds the
+// GoonHub values the importer derived from the snapshot's values: GoonHub still
+// holding one of them hasn't changed.
+func planPair(p EntityPair, snap, imported entityFields) SyncPlan {
+	plan := SyncPlan{
+		Pair:    p,
+		ToGH:    make(entityFields),
+		ToStash: make(entityFields),
+		Agreed:  make(entityFields),
+	}
+
+	keys := make([]string, 0, len(p.Stash))
+	for k := range p.Stash {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		sv, gv := p.Stash[k], p.GH[k]
+		base, hasBase := snap[k]
+		derived, hasDerived := imported[k]
+		switch {
+		case sv == gv:
+			plan.Agreed[k] = sv
+		case hasBase && (gv == base || hasDerived && gv == derived):
+			plan.ToGH[k] = sv
+		case hasBase && sv == base:
+			plan.ToStash[k] = gv
+		default:
+			plan.Conflicts = append(plan.Conflicts, FieldConflict{Field: k, Base: base, Stash: sv, GH: gv})
+		}
+	}
+	return plan
+}
+
+// resolve settles a conflict per the strategy and moves the winning value into the plan.
+func (s *Sync) resolve(plan *SyncPlan, c *FieldConflict) {
+	switch s.resolution {
+	case resolveStash, resolveGoonHub:
+		c.Resolution = s.resolution
+	case resolveNewest:
+		stashAt, ghAt := plan.Pair.StashUpdated, plan.Pair.GHUpdated
+		switch {
+		case stashAt.IsZero() || ghAt.IsZero() || stashAt.Equal(ghAt):
+			// No way to tell; leave it for a human.
+		case stashAt.After(ghAt):
+			c.Resolution = resolveStash
+		default:
+			c.Resolution = resolveGoonHub
+		}
+	case resolveAsk:
+		if s.prompt != nil {
+			c.Resolution = s.ask(plan.Pair, *c)
+		}
+	}
+
+	switch c.Resolution {
+	case resolveStash:
+		plan.ToGH[c.Field] = c.Stash
+	case resolveGoonHub:
+		plan.ToStash[c.Field] = c.GH
+	}
+}
+
+func (s *Sync) ask(p EntityPair, c FieldConflict) string {
+	fmt.Printf("\n[Sync]    Conflict on %s %q field %s\n", p.Kind, p.Label, c.Field)
+	fmt.Printf("[Sync]      stash:   %q\n", c.Stash)
+	fmt.Printf("[Sync]      goonhub: %q\n", c.GH)
+	for {
+		fmt.Print("[Sync]    Keep [s]tash, [g]oonhub or s[k]ip? ")
+		line, err := s.prompt.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "s", "stash":
+			return resolveStash
+		case "g", "goonhub":
+			return resolveGoonHub
+		case "k", "skip":
+			return ""
+		}
+		if err != nil {
+			// stdin closed: stop asking and leave the rest unresolved.
+			s.prompt = nil
+			return ""
+		}
+	}
+}
+
+// Apply writes each plan to GoonHub then Stash. The snapshot is only advanced for
+// fields that now agree, so a failed write is retried on the next run.
+func (s *Sync) Apply(plans []SyncPlan) PhaseStats {
+	stats := PhaseStats{}
+	total := len(plans)
+	fmt.Printf("\n[Sync]    Applying %d entities...\n", total)
+
+	for i, plan := range plans {
+		p := plan.Pair
+		idx := fmt.Sprintf("[%*d/%d]", digits(total), i+1, total)
+		agreed := plan.Agreed
+		wrote := false
+		failed := false
+
+		if len(plan.ToGH) > 0 {
+			if err := updateGoonHub(s.gh, s.idMap, p.Kind, p.GHID, plan.ToGH); err != nil {
+				fmt.Printf("[Sync]    %s ERROR updating GoonHub %s %q: %v\n", idx, p.Kind, p.Label, err)
+				failed = true
+			} else {
+				for k, v := range plan.ToGH {
+					agreed[k] = v
+				}
+				wrote = true
+			}
+		}
+		if len(plan.ToStash) > 0 {
+			if err := updateStash(s.stash, p.Kind, p.StashID, plan.ToStash); err != nil {
+				fmt.Printf("[Sync]    %s ERROR updating Stash %s %q: %v\n", idx, p.Kind, p.Label, err)
+				failed = true
+			} else {
+				for k, v := range plan.ToStash {
+					agreed[k] = v
+				}
+				wrote = true
+			}
+		}
+		s.state.record(p.Kind, p.StashID, agreed, p.Imported)
+
+		switch {
+		case failed:
+			stats.Errors++
+		case wrote:
+			fmt.Printf("[Sync]    %s Synced %s %q (to GoonHub:%d to Stash:%d)\n",
+				idx, p.Kind, p.Label, len(plan.ToGH), len(plan.ToStash))
+			stats.Updated++
+		default:
+			stats.Skipped++
+		}
+	}
+	return stats
+}
+
+// updateGoonHub writes Stash-terms field values to a GoonHub entity, mapping Stash
+// IDs through IDMap. Stash references that were never imported are ignored.
+func updateGoonHub(gh *GoonHubClient, idMap *IDMap, kind string, ghID uint, fields entityFields) error {
+	switch kind {
+	case "tag":
+		if name, ok := fields["name"]; ok {
+			return gh.UpdateTag(ghID, GHUpdateTagRequest{Name: name})
+		}
+		return nil
+	case "performer":
+		return gh.UpdateActor(ghID, ghActorUpdate(fields))
+	case "scene":
+		return updateGoonHubScene(gh, idMap, ghID, fields)
+	}
+	return fmt.Errorf("unknown entity kind %q", kind)
+}
+
+func ghActorUpdate(fields entityFields) GHUpdateActorRequest {
+	var req GHUpdateActorRequest
+	str := func(field string) *string {
+		v, ok := fields[field]
+		if !ok {
+			return nil
+		}
+		return &v
+	}
+	num := func(field string) *int {
+		v, ok := fields[field]
+		if !ok {
+			return nil
+		}
+		n, _ := strconv.Atoi(v) // "" clears to 0
+		return &n
+	}
+
+	req.Name = str("name")
+	if g := str("gender"); g != nil {
+		lower := strings.ToLower(*g)
+		req.Gender = &lower
+	}
+	req.Birthday = str("birthdate")
+	req.DateOfDeath = str("death_date")
+	req.Ethnicity = str("ethnicity")
+	req.Nationality = str("country")
+	req.EyeColor = str("eye_color")
+	req.HeightCm = num("height_cm")
+	req.Measurements = str("measurements")
+	req.Tattoos = str("tattoos")
+	req.Piercings = str("piercings")
+	req.HairColor = str("hair_color")
+	req.WeightKg = num("weight")
+	return req
+}
+
+func updateGoonHubScene(gh *GoonHubClient, idMap *IDMap, ghID uint, fields entityFields) error {
+	var req GHUpdateSceneRequest
+	hasScalar := false
+	for field, ptr := range map[string]**string{"title": &req.Title, "details": &req.Description, "date": &req.ReleaseDate} {
+		if v, ok := fields[field]; ok {
+			*ptr = &v
+			hasScalar = true
+		}
+	}
+	if hasScalar {
+		if err := gh.UpdateScene(ghID, req); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := fields["studio_id"]; ok {
+		// An empty studio means the other side cleared it.
+		var studioID *uint
+		if v != "" {
+			id, mapped := idMap.Studios[v]
+			if !mapped {
+				return fmt.Errorf("studio %q is not in the id map, can't set it on GoonHub", v)
+			}
+			studioID = &id
+		}
+		if err := gh.SetSceneStudio(ghID, studioID); err != nil {
+			return err
+		}
+	}
+	if v, ok := fields["tag_ids"]; ok {
+		if err := gh.SetSceneTags(ghID, mapIDList(v, idMap.Tags)); err != nil {
+			return err
+		}
+	}
+	if v, ok := fields["performer_ids"]; ok {
+		if err := gh.SetSceneActors(ghID, mapIDList(v, idMap.Actors)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapIDList maps a comma-joined list of Stash IDs to GoonHub IDs, dropping unmapped ones.
+func mapIDList(list string, m map[string]uint) []uint {
+	ids := []uint{}
+	for _, id := range splitList(list, ",") {
+		if ghID, ok := m[id]; ok {
+			ids = append(ids, ghID)
+		}
+	}
+	return ids
+}
+
+// printSyncPlans prints each plan and returns the number of unresolved conflicts.
+func printSyncPlans(plans []SyncPlan) int {
+	var toGH, toStash, unresolved int
+	for _, plan := range plans {
+		p := plan.Pair
+		fmt.Printf("\n[Sync]    %s %q (stash:%s <-> gh:%d)\n", p.Kind, p.Label, p.StashID, p.GHID)
+		for _, k := range sortedKeys(plan.ToGH) {
+			fmt.Printf("[Sync]        -> goonhub %s: %q -> %q\n", k, p.GH[k], plan.ToGH[k])
+		}
+		for _, k := range sortedKeys(plan.ToStash) {
+			fmt.Printf("[Sync]        -> stash   %s: %q -> %q\n", k, p.Stash[k], plan.ToStash[k])
+		}
+		for _, c := range plan.Conflicts {
+			if c.Resolution == "" {
+				fmt.Printf("[Sync]        CONFLICT %s: stash %q, goonhub %q\n", c.Field, c.Stash, c.GH)
+				unresolved++
+			}
+		}
+		if len(plan.ToGH) > 0 {
+			toGH++
+		}
+		if len(plan.ToStash) > 0 {
+			toStash++
+		}
+	}
+	fmt.Printf("\n[Sync]    %d entities to sync (to GoonHub:%d to Stash:%d), %d unresolved conflicts\n",
+		len(plans), toGH, toStash, unresolved)
+	return unresolved
+}
+
+func sortedKeys(m entityFields) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SyncState records, per paired entity, the field values both sides last agreed on.
+// The sync command compares each side against it to tell which one changed.
+type SyncState struct {
+	LastSync   time.Time               `json:"last_sync"`
+	Tags       map[string]entityFields `json:"tags"`
+	Performers map[string]entityFields `json:"performers"`
+	Scenes     map[string]entityFields `json:"scenes"`
+	// Imported holds, by "<kind>:<stash id>", the GoonHub values that stood for
+	// an agreed value because the importer derived them from it (see
+	// EntityPair.Imported).
+	Imported map[string]entityFields `json:"imported,omitempty"`
+}
+
+func NewSyncState() *SyncState {
+	return &SyncState{
+		Tags:       make(map[string]entityFields),
+		Performers: make(map[string]entityFields),
+		Scenes:     make(map[string]entityFields),
+		Imported:   make(map[string]entityFields),
+	}
+}
+
+// LoadSyncState reads the sync state from a JSON file. Returns a new empty state if the file doesn't exist.
+func LoadSyncState(path string) (*SyncState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewSyncState(), nil
+		}
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	state := NewSyncState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state: %w", err)
+	}
+	if state.Tags == nil {
+		state.Tags = make(map[string]entityFields)
+	}
+	if state.Performers == nil {
+		state.Performers = make(map[string]entityFields)
+	}
+	if state.Scenes == nil {
+		state.Scenes = make(map[string]entityFields)
+	}
+	if state.Imported == nil {
+		state.Imported = make(map[string]entityFields)
+	}
+	return state, nil
+}
+
+// Save writes the sync state to a JSON file, replacing it atomically so a crash
+// leaves either the old or the new state.
+func (s *SyncState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync state: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
+
+// snapshot returns the stored fields for a pair, or nil if it has never been synced.
+func (s *SyncState) snapshot(kind, stashID string) entityFields {
+	return s.kind(kind)[stashID]
+}
+
+// imported returns the importer-derived GoonHub values stored for a pair, or nil.
+func (s *SyncState) imported(kind, stashID string) entityFields {
+	return s.Imported[kind+":"+stashID]
+}
+
+// record stores agreed field values for a pair, keeping fields not in agreed.
+// imported has the GoonHub values that stand for agreed ones; agreed fields not
+// in it lose any stored before.
+func (s *SyncState) record(kind, stashID string, agreed, imported entityFields) {
+	if len(agreed) == 0 {
+		return
+	}
+	m := s.kind(kind)
+	snap := m[stashID]
+	if snap == nil {
+		snap = make(entityFields, len(agreed))
+		m[stashID] = snap
+	}
+	key := kind + ":" + stashID
+	derived := s.Imported[key]
+	for k, v := range agreed {
+		snap[k] = v
+		if iv, ok := imported[k]; ok {
+			if derived == nil {
+				derived = make(entityFields)
+				s.Imported[key] = derived
+			}
+			derived[k] = iv
+		} else {
+			delete(derived, k)
+		}
+	}
+	if derived != nil && len(derived) == 0 {
+		delete(s.Imported, key)
+	}
+}
+
+func (s *SyncState) kind(kind string) map[string]entityFields {
+	switch kind {
+	case "tag":
+		return s.Tags
+	case "performer":
+		return s.Performers
+	default:
+		return s.Scenes
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TagRules clean up source tags on their way to GoonHub. Rules match source tag
+// names case-insensitively:
+//
+//	rename: source name -> GoonHub name
+//	merge:  GoonHub name -> source names that all become that one tag
+//	drop:   source names that aren't imported at all
+//
+// A tag may appear in one rule only.
+type TagRules struct {
+	Rename map[string]string   `json:"rename"`
+	Merge  map[string][]string `json:"merge"`
+	Drop   []string            `json:"drop"`
+
+	targets map[string]string // lower-cased source name -> GoonHub name
+	drops   map[string]bool   // lower-cased source name
+}
+
+// LoadTagRules reads the tag rules file. The file is optional: returns empty
+// rules if it doesn't exist.
+func LoadTagRules(path string) (*TagRules, error) {
+	rules := &TagRules{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, rules.compile()
+		}
+		return nil, fmt.Errorf("failed to read tag rules: %w", err)
+	}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("failed to parse tag rules: %w", err)
+	}
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid tag rules in %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func (r *TagRules) compile() error {
+	r.targets = make(map[string]string)
+	r.drops = make(map[string]bool)
+	seen := make(map[string]string)
+	claim := func(name, rule string) error {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			return fmt.Errorf("empty tag name in %s", rule)
+		}
+		if prev, ok := seen[key]; ok {
+			return fmt.Errorf("tag %q is in both %s and %s", name, prev, rule)
+		}
+		seen[key] = rule
+		return nil
+	}
+
+	for from, to := range r.Rename {
+		if err := claim(from, "rename"); err != nil {
+			return err
+		}
+		if strings.TrimSpace(to) == "" {
+			return fmt.Errorf("rename of %q has no target name", from)
+		}
+		r.targets[strings.ToLower(strings.TrimSpace(from))] = strings.TrimSpace(to)
+	}
+	for to, froms := range r.Merge {
+		if strings.TrimSpace(to) == "" {
+			return fmt.Errorf("merge has an empty target name")
+		}
+		for _, from := range froms {
+			if err := claim(from, fmt.Sprintf("merge into %q", to)); err != nil {
+				return err
+			}
+			r.targets[strings.ToLower(strings.TrimSpace(from))] = strings.TrimSpace(to)
+		}
+	}
+	for _, name := range r.Drop {
+		if err := claim(name, "drop"); err != nil {
+			return err
+		}
+		r.drops[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	return nil
+}
+
+func (r *TagRules) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.targets) + len(r.drops)
+}
+
+// target returns the GoonHub name for a source tag, or false if it's dropped.
+func (r *TagRules) target(name string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if r.drops[key] {
+		return "", false
+	}
+	if to, ok := r.targets[key]; ok {
+		return to, true
+	}
+	return name, true
+}
+
+// tagResolver applies TagRules to a set of source tags. Tags that end up with the
+// same GoonHub name share one canonical source tag: only that one is imported
+// and mapped, and the others resolve to it wherever a tag ID is used.
+type tagResolver struct {
+	names     map[string]string // canonical source ID -> GoonHub name
+	canonical map[string]string // source ID -> canonical source ID
+	dropped   map[string]bool
+}
+
+// Resolve groups tags by their GoonHub name. The canonical tag of a group is one
+// that is already mapped, else one already carrying the target name, else the
+// first one, so re-runs keep using the tag they imported before.
+func (r *TagRules) Resolve(tags []SourceTag, mapped map[string]uint) *tagResolver {
+	t := &tagResolver{
+		names:     make(map[string]string),
+		canonical: make(map[string]string),
+		dropped:   make(map[string]bool),
+	}
+	groups := make(map[string][]SourceTag)
+	var order []string
+	for _, tag := range tags {
+		name, ok := r.target(tag.Name)
+		if !ok {
+			t.dropped[tag.ID] = true
+			continue
+		}
+		key := strings.ToLower(name)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], tag)
+	}
+
+	for _, key := range order {
+		group := groups[key]
+		name, _ := r.target(group[0].Name)
+		best := -1
+		for i, tag := range group {
+			if _, ok := mapped[tag.ID]; ok {
+				best = i
+				break
+			}
+			if best < 0 && strings.EqualFold(tag.Name, name) {
+				best = i
+			}
+		}
+		if best < 0 {
+			best = 0
+		}
+		canon := group[best].ID
+		t.names[canon] = name
+		for _, tag := range group {
+			t.canonical[tag.ID] = canon
+		}
+	}
+	return t
+}
+
+// resolve returns the canonical source ID for a tag, or false if it's dropped.
+// A nil resolver, or an ID it doesn't know, passes the ID through.
+func (t *tagResolver) resolve(id string) (string, bool) {
+	if t == nil {
+		return id, true
+	}
+	if t.dropped[id] {
+		return "", false
+	}
+	if c, ok := t.canonical[id]; ok {
+		return c, true
+	}
+	return id, true
+}
+
+// name returns the GoonHub name for a canonical tag.
+func (t *tagResolver) name(tag SourceTag) string {
+	if t == nil {
+		return tag.Name
+	}
+	if n, ok := t.names[tag.ID]; ok {
+		return n
+	}
+	return tag.Name
+}
@@ -0,0 +1,175 @@
+package main
+
+import "testing"
+
+func mustCompileTagRules(t *testing.T, r *TagRules) *TagRules {
+	t.Helper()
+	if err := r.compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return r
+}
+
+func TestTagRulesTarget(t *testing.T) {
+	rules := mustCompileTagRules(t, &TagRules{
+		Rename: map[string]string{"Blond": "Blonde", " outside ": " Outdoor "},
+		Merge:  map[string][]string{"Big Tits": {"big boobs", "Busty"}},
+		Drop:   []string{"Unimported", "4K"},
+	})
+
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"rename", "Blond", "Blonde", true},
+		{"rename ignores case", "BLOND", "Blonde", true},
+		{"rename trims names", "Outside", "Outdoor", true},
+		{"merge", "Busty", "Big Tits", true},
+		{"merge ignores case", "Big Boobs", "Big Tits", true},
+		{"drop", "Unimported", "", false},
+		{"drop ignores case", "4k", "", false},
+		{"no rule", "Redhead", "Redhead", true},
+		{"merge target itself", "Big Tits", "Big Tits", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rules.target(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("target(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTagRulesCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules TagRules
+	}{
+		{"renamed and dropped", TagRules{Rename: map[string]string{"Blond": "Blonde"}, Drop: []string{"blond"}}},
+		{"merged and dropped", TagRules{Merge: map[string][]string{"Blonde": {"Blond"}}, Drop: []string{"BLOND"}}},
+		{"in two merges", TagRules{Merge: map[string][]string{"A": {"x"}, "B": {"X"}}}},
+		{"dropped twice", TagRules{Drop: []string{"x", " X "}}},
+		{"empty rename source", TagRules{Rename: map[string]string{" ": "Blonde"}}},
+		{"empty rename target", TagRules{Rename: map[string]string{"Blond": " "}}},
+		{"empty merge target", TagRules{Merge: map[string][]string{"": {"Blond"}}}},
+		{"empty drop", TagRules{Drop: []string{""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.compile(); err == nil {
+				t.Error("compile accepted invalid rules")
+			}
+		})
+	}
+}
+
+func TestTagRulesResolve(t *testing.T) {
+	rules := mustCompileTagRules(t, &TagRules{
+		Rename: map[string]string{"Outside": "Outdoor"},
+		Merge:  map[string][]string{"Blonde": {"Blond", "Blonde Hair"}},
+		Drop:   []string{"Unimported"},
+	})
+
+	tests := []struct {
+		name      string
+		tags      []SourceTag
+		mapped    map[string]uint
+		canonical map[string]string // source ID -> canonical source ID, "" if dropped
+		names     map[string]string // canonical source ID -> GoonHub name
+	}{
+		{
+			name:      "first in group",
+			tags:      []SourceTag{{"1", "Blond"}, {"2", "Blonde Hair"}},
+			canonical: map[string]string{"1": "1", "2": "1"},
+			names:     map[string]string{"1": "Blonde"},
+		},
+		{
+			name:      "exact name preferred",
+			tags:      []SourceTag{{"1", "Blond"}, {"2", "blonde"}, {"3", "Blonde Hair"}},
+			canonical: map[string]string{"1": "2", "2": "2", "3": "2"},
+			names:     map[string]string{"2": "Blonde"},
+		},
+		{
+			name:      "mapped preferred over exact name",
+			tags:      []SourceTag{{"1", "Blonde"}, {"2", "Blond"}, {"3", "Blonde Hair"}},
+			mapped:    map[string]uint{"3": 103},
+			canonical: map[string]string{"1": "3", "2": "3", "3": "3"},
+			names:     map[string]string{"3": "Blonde"},
+		},
+		{
+			name:      "first mapped wins",
+			tags:      []SourceTag{{"1", "Blond"}, {"2", "Blonde Hair"}},
+			mapped:    map[string]uint{"1": 101, "2": 102},
+			canonical: map[string]string{"1": "1", "2": "1"},
+			names:     map[string]string{"1": "Blonde"},
+		},
+		{
+			name:      "rename joins existing tag",
+			tags:      []SourceTag{{"1", "Outside"}, {"2", "Outdoor"}},
+			canonical: map[string]string{"1": "2", "2": "2"},
+			names:     map[string]string{"2": "Outdoor"},
+		},
+		{
+			name:      "rename alone",
+			tags:      []SourceTag{{"1", "outside"}},
+			canonical: map[string]string{"1": "1"},
+			names:     map[string]string{"1": "Outdoor"},
+		},
+		{
+			name:      "same name without a rule",
+			tags:      []SourceTag{{"1", "Redhead"}, {"2", "redhead"}},
+			canonical: map[string]string{"1": "1", "2": "1"},
+			names:     map[string]string{"1": "Redhead"},
+		},
+		{
+			name:      "drop",
+			tags:      []SourceTag{{"1", "Unimported"}, {"2", "Redhead"}},
+			canonical: map[string]string{"1": "", "2": "2"},
+			names:     map[string]string{"2": "Redhead"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rules.Resolve(tt.tags, tt.mapped)
+			for id, want := range tt.canonical {
+				got, ok := r.resolve(id)
+				if want == "" {
+					if ok {
+						t.Errorf("resolve(%q) = %q, want dropped", id, got)
+					}
+					continue
+				}
+				if !ok || got != want {
+					t.Errorf("resolve(%q) = %q, %v, want %q", id, got, ok, want)
+				}
+			}
+			for _, tag := range tt.tags {
+				want, canonical := tt.names[tag.ID]
+				if !canonical {
+					continue
+				}
+				if got := r.name(tag); got != want {
+					t.Errorf("name(%q) = %q, want %q", tag.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTagResolverPassThrough(t *testing.T) {
+	var nilResolver *tagResolver
+	if got, ok := nilResolver.resolve("7"); !ok || got != "7" {
+		t.Errorf("nil resolve(7) = %q, %v, want 7", got, ok)
+	}
+	if got := nilResolver.name(SourceTag{"7", "Blond"}); got != "Blond" {
+		t.Errorf("nil name = %q, want Blond", got)
+	}
+
+	r := mustCompileTagRules(t, &TagRules{}).Resolve([]SourceTag{{"1", "Blond"}}, nil)
+	if got, ok := r.resolve("9"); !ok || got != "9" {
+		t.Errorf("resolve of an unknown ID = %q, %v, want 9", got, ok)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Transforms rewrite GoonHub request fields before they're sent, with one Go
+// template per field and entity type:
+//
+//	{"scenes": {"title": "{{ .title | trimSuffix \" [SiteRip]\" | title }}"}}
+//
+// Templates see the request's fields by JSON name (missing values are empty)
+// and the source entity as .source. Every template of an entity sees the request
+// as it was built, not the output of the other templates. The output replaces the
+// field; an empty output clears it.
+type Transforms struct {
+	raw       map[string]map[string]string
+	templates map[string]map[string]*template.Template // phase -> field -> template
+}
+
+// transformPhases maps the entity types of the transforms file to their phase
+// and request type.
+var transformPhases = map[string]struct {
+	phase string
+	req   any
+}{
+	"tags":    {"Tags", GHCreateTagRequest{}},
+	"studios": {"Studios", GHCreateStudioRequest{}},
+	"actors":  {"Actors", GHCreateActorRequest{}},
+	"scenes":  {"Scenes", GHImportSceneRequest{}},
+}
+
+// LoadTransforms reads the transforms file. The file is optional: returns empty
+// transforms if it doesn't exist.
+func LoadTransforms(path string) (*Transforms, error) {
+	t := &Transforms{templates: make(map[string]map[string]*template.Template)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("failed to read transforms: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse transforms: %w", err)
+	}
+
+	for kind, fields := range t.raw {
+		p, ok := transformPhases[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown entity type %q in %s (expected tags, studios, actors or scenes)", kind, path)
+		}
+		t.templates[p.phase] = make(map[string]*template.Template)
+		for field, text := range fields {
+			f, ok := requestField(reflect.TypeOf(p.req), field)
+			if !ok || !settable(f.Type) {
+				return nil, fmt.Errorf("%s.%s in %s: not a transformable request field", kind, field, path)
+			}
+			tmpl, err := template.New(kind + "." + field).Option("missingkey=error").Funcs(transformFuncs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform in %s: %w", path, err)
+			}
+			t.templates[p.phase][field] = tmpl
+		}
+	}
+	return t, nil
+}
+
+func (t *Transforms) Len() int {
+	if t == nil {
+		return 0
+	}
+	n := 0
+	for _, fields := range t.templates {
+		n += len(fields)
+	}
+	return n
+}
+
+// MarshalJSON lets plan fingerprints cover the transforms.
+func (t *Transforms) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.raw)
+}
+
+// Apply runs the phase's templates over req, a pointer to a request struct.
+func (t *Transforms) Apply(phase string, req any, source any) error {
+	if t == nil || len(t.templates[phase]) == 0 {
+		return nil
+	}
+
+	// The template data: the request by JSON name, with nulls as empty strings.
+	// Numbers stay json.Number so they render as written rather than as floats.
+	var data map[string]any
+	raw, err := json.Marshal(req)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		err = dec.Decode(&data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prepare transform data: %w", err)
+	}
+	v := reflect.ValueOf(req).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i))
+		if data[name] == nil {
+			data[name] = ""
+		}
+	}
+	data["source"] = source
+
+	fields := make([]string, 0, len(t.templates[phase]))
+	for field := range t.templates[phase] {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		var out bytes.Buffer
+		if err := t.templates[phase][field].Execute(&out, data); err != nil {
+			return fmt.Errorf("transform %s failed: %w", field, err)
+		}
+		f, _ := requestField(v.Type(), field)
+		if err := setField(v.FieldByIndex(f.Index), strings.TrimSpace(out.String())); err != nil {
+			return fmt.Errorf("transform %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+func requestField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if jsonName(t.Field(i)) == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// settable reports whether setField can assign template output to a field of type t.
+func settable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setField parses s into the field. Empty clears it (nil for pointers).
+func setField(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := setField(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if s == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected a positive integer, got %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", s)
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// transformFuncs are available in transform templates. Functions taking the
+// value to transform take it last, so they work in pipelines.
+var transformFuncs = template.FuncMap{
+	"title":      titleCase,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"regexReplace": func(pattern, repl, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+	// regexFind returns the first capture group of the first match, or the whole
+	// match if the pattern has no groups.
+	"regexFind": func(pattern, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		m := re.FindStringSubmatch(s)
+		switch {
+		case m == nil:
+			return "", nil
+		case len(m) > 1:
+			return m[1], nil
+		}
+		return m[0], nil
+	},
+	// date reformats s from a Go time layout to YYYY-MM-DD, or returns "".
+	"date": func(layout, s string) string {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	"default": func(def string, v any) string {
+		if s := fmt.Sprint(v); s != "" {
+			return s
+		}
+		return def
+	},
+}
+
+// titleCase upper-cases the first letter of every word and lower-cases the rest.
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r := []rune(strings.ToLower(w))
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func loadTestTransforms(t *testing.T, rules map[string]map[string]string) (*Transforms, error) {
+	t.Helper()
+	data, err := json.Marshal(rules)
+	if err != nil {
+		t.Fatalf("marshal transforms: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "transforms.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write transforms: %v", err)
+	}
+	return LoadTransforms(path)
+}
+
+func TestTransformTemplates(t *testing.T) {
+	base := GHImportSceneRequest{
+		Title:      "my  clip [SiteRip]",
+		Size:       123456789012,
+		Duration:   62,
+		FrameRate:  29.97,
+		VideoCodec: "h264",
+	}
+	source := map[string]any{"code": "ABC-123", "date": "15.03.2024"}
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"field", "{{ .title }}", "my  clip [SiteRip]"},
+		{"pipeline", `{{ .title | trimSuffix " [SiteRip]" | title }}`, "My Clip"},
+		{"upper", "{{ .video_codec | upper }}", "H264"},
+		{"replace", `{{ .title | replace "clip" "scene" }}`, "my  scene [SiteRip]"},
+		{"regexReplace", `{{ .title | regexReplace "\\s*\\[.*\\]" "" }}`, "my  clip"},
+		{"regexFind group", `{{ .title | regexFind "\\[(\\w+)\\]" }}`, "SiteRip"},
+		{"regexFind no match", `{{ .title | regexFind "\\d+" }}`, ""},
+		{"source field", "{{ .source.code }} {{ .title | trimSuffix \" [SiteRip]\" }}", "ABC-123 my  clip"},
+		{"date", `{{ .source.date | date "02.01.2006" }}`, "2024-03-15"},
+		{"date no match", `{{ .title | date "2006-01-02" }}`, ""},
+		{"missing value is empty", "[{{ .description }}]", "[]"},
+		{"null pointer is empty", "[{{ .release_date }}]", "[]"},
+		{"default", `{{ .description | default "none" }}`, "none"},
+		{"default keeps value", `{{ .video_codec | default "none" }}`, "h264"},
+		{"large integer as written", "{{ .title }} {{ .size }}", "my  clip [SiteRip] 123456789012"},
+		{"float as written", "{{ .title }} {{ .frame_rate }}", "my  clip [SiteRip] 29.97"},
+		{"output trimmed", "  {{ .video_codec }}\n", "h264"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := loadTestTransforms(t, map[string]map[string]string{"scenes": {"title": tt.tmpl}})
+			if err != nil {
+				t.Fatalf("LoadTransforms: %v", err)
+			}
+			req := base
+			if err := tr.Apply("Scenes", &req, source); err != nil {
+				t.Fatalf("Apply(%q): %v", tt.tmpl, err)
+			}
+			if req.Title != tt.want {
+				t.Errorf("Apply(%q) title = %q, want %q", tt.tmpl, req.Title, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformSetField(t *testing.T) {
+	date := "2024-03-15"
+	studio := uint(7)
+	height := 170
+
+	tests := []struct {
+		name    string
+		kind    string
+		field   string
+		tmpl    string
+		req     any
+		want    any
+		wantErr bool
+	}{
+		{"int", "scenes", "duration", "90", &GHImportSceneRequest{Duration: 62}, &GHImportSceneRequest{Duration: 90}, false},
+		{"int64", "scenes", "size", "123456789012", &GHImportSceneRequest{}, &GHImportSceneRequest{Size: 123456789012}, false},
+		{"float", "scenes", "frame_rate", "25", &GHImportSceneRequest{}, &GHImportSceneRequest{FrameRate: 25}, false},
+		{"bool", "scenes", "skip_file_check", "true", &GHImportSceneRequest{}, &GHImportSceneRequest{SkipFileCheck: true}, false},
+		{"bool false", "actors", "fake_boobs", "false", &GHCreateActorRequest{FakeBoobs: true}, &GHCreateActorRequest{}, false},
+		{"string pointer", "scenes", "release_date", "2024-03-15", &GHImportSceneRequest{}, &GHImportSceneRequest{ReleaseDate: &date}, false},
+		{"uint pointer", "scenes", "studio_id", "7", &GHImportSceneRequest{}, &GHImportSceneRequest{StudioID: &studio}, false},
+		{"int pointer", "actors", "height_cm", "170", &GHCreateActorRequest{}, &GHCreateActorRequest{HeightCm: &height}, false},
+		{"empty clears pointer", "scenes", "release_date", "", &GHImportSceneRequest{ReleaseDate: &date}, &GHImportSceneRequest{}, false},
+		{"empty clears value", "scenes", "duration", "", &GHImportSceneRequest{Duration: 62}, &GHImportSceneRequest{}, false},
+		{"empty clears string", "actors", "gender", "", &GHCreateActorRequest{Gender: "female"}, &GHCreateActorRequest{}, false},
+		{"bad int", "scenes", "duration", "1m30s", &GHImportSceneRequest{}, nil, true},
+		{"bad float", "scenes", "frame_rate", "fast", &GHImportSceneRequest{}, nil, true},
+		{"bad bool", "scenes", "skip_file_check", "yes", &GHImportSceneRequest{}, nil, true},
+		{"negative uint", "scenes", "studio_id", "-1", &GHImportSceneRequest{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := loadTestTransforms(t, map[string]map[string]string{tt.kind: {tt.field: tt.tmpl}})
+			if err != nil {
+				t.Fatalf("LoadTransforms: %v", err)
+			}
+			err = tr.Apply(transformPhases[tt.kind].phase, tt.req, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Apply(%s = %q) succeeded, want an error", tt.field, tt.tmpl)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply(%s = %q): %v", tt.field, tt.tmpl, err)
+			}
+			if !reflect.DeepEqual(tt.req, tt.want) {
+				t.Errorf("Apply(%s = %q) = %+v, want %+v", tt.field, tt.tmpl, tt.req, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformsSeeRequestAsBuilt(t *testing.T) {
+	tr, err := loadTestTransforms(t, map[string]map[string]string{
+		"scenes": {"title": "{{ .description }}", "description": "{{ .title }}"},
+	})
+	if err != nil {
+		t.Fatalf("LoadTransforms: %v", err)
+	}
+	req := GHImportSceneRequest{Title: "a", Description: "b"}
+	if err := tr.Apply("Scenes", &req, nil); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if req.Title != "b" || req.Description != "a" {
+		t.Errorf("Apply swapped to title %q, description %q, want \"b\", \"a\"", req.Title, req.Description)
+	}
+}
+
+func TestLoadTransformsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]map[string]string
+	}{
+		{"unknown entity type", map[string]map[string]string{"markers": {"title": "x"}}},
+		{"unknown field", map[string]map[string]string{"scenes": {"name": "x"}}},
+		{"unknown function", map[string]map[string]string{"scenes": {"title": "{{ .title | shout }}"}}},
+		{"unclosed action", map[string]map[string]string{"scenes": {"title": "{{ .title"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadTestTransforms(t, tt.rules); err == nil {
+				t.Error("LoadTransforms accepted invalid transforms")
+			}
+		})
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"hello world", "Hello World"},
+		{"HELLO  wORLD ", "Hello World"},
+		{"élan vital", "Élan Vital"},
+	}
+	for _, tt := range tests {
+		if got := titleCase(tt.in); got != tt.want {
+			t.Errorf("titleCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}